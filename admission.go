@@ -0,0 +1,131 @@
+package goRPC
+
+import "fmt"
+
+// ServerLimits 服务端准入控制配置，所有字段为 0 表示不限制。
+// 超过限制的请求不会被处理，立即返回错误码为 ResourceExhausted 的错误
+type ServerLimits struct {
+	MaxConcurrency     int                     // 全局同时处理的请求数
+	QPS                float64                 // 全局每秒处理的请求数
+	Burst              int                     // 全局令牌桶容量
+	MaxConnConcurrency int                     // 每个连接同时处理的请求数，避免一个客户端占满服务端
+	ConnQPS            float64                 // 每个连接每秒处理的请求数
+	ConnBurst          int                     // 每个连接的令牌桶容量
+	Methods            map[string]MethodLimits // 单个方法的限制，键是 "Service.Method"
+}
+
+// MethodLimits 单个方法的并发和速率限制
+type MethodLimits struct {
+	MaxConcurrency int
+	QPS            float64
+	Burst          int
+}
+
+// ErrResourceExhausted 服务端拒绝请求时返回的错误
+var ErrResourceExhausted = NewError(ResourceExhausted, "rpc server: resource exhausted")
+
+// limiter 组合了并发数限制和令牌桶
+type limiter struct {
+	sem    chan struct{} // 并发数限制，nil 表示不限制
+	bucket *TokenBucket  // 速率限制，nil 表示不限制
+}
+
+// 没有任何限制时返回 nil
+func newLimiter(maxConcurrency int, qps float64, burst int) *limiter {
+	if maxConcurrency <= 0 && qps <= 0 {
+		return nil
+	}
+	l := new(limiter)
+	if maxConcurrency > 0 {
+		l.sem = make(chan struct{}, maxConcurrency)
+	}
+	if qps > 0 {
+		l.bucket = NewTokenBucket(qps, burst)
+	}
+	return l
+}
+
+// 非阻塞地获取许可，nil 表示不限制，总是成功
+func (l *limiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	if l.bucket != nil && !l.bucket.Allow() {
+		l.release()
+		return false
+	}
+	return true
+}
+
+func (l *limiter) release() {
+	if l != nil && l.sem != nil {
+		<-l.sem
+	}
+}
+
+// admission 服务端的准入控制状态
+type admission struct {
+	limits  ServerLimits
+	global  *limiter
+	methods map[string]*limiter
+}
+
+func newAdmission(limits ServerLimits) *admission {
+	a := &admission{
+		limits:  limits,
+		global:  newLimiter(limits.MaxConcurrency, limits.QPS, limits.Burst),
+		methods: make(map[string]*limiter),
+	}
+	for serviceMethod, m := range limits.Methods {
+		if l := newLimiter(m.MaxConcurrency, m.QPS, m.Burst); l != nil {
+			a.methods[serviceMethod] = l
+		}
+	}
+	return a
+}
+
+// 每个连接一个 limiter，没有配置连接级限制时返回 nil
+func (a *admission) newConnLimiter() *limiter {
+	if a == nil {
+		return nil
+	}
+	return newLimiter(a.limits.MaxConnConcurrency, a.limits.ConnQPS, a.limits.ConnBurst)
+}
+
+// 依次检查连接、方法和全局的限制，全部通过时返回释放许可的函数，
+// 任意一级被拒绝时释放已经获取的许可并返回错误
+func (a *admission) admit(conn *limiter, serviceMethod string) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	if !conn.acquire() {
+		return nil, fmt.Errorf("%w: connection limit exceeded", ErrResourceExhausted)
+	}
+	method := a.methods[serviceMethod]
+	if !method.acquire() {
+		conn.release()
+		return nil, fmt.Errorf("%w: method limit exceeded: %s", ErrResourceExhausted, serviceMethod)
+	}
+	if !a.global.acquire() {
+		method.release()
+		conn.release()
+		return nil, fmt.Errorf("%w: server limit exceeded", ErrResourceExhausted)
+	}
+	return func() {
+		a.global.release()
+		method.release()
+		conn.release()
+	}, nil
+}
+
+// SetLimits 设置准入控制，需要在 Accept 之前调用
+func (server *Server) SetLimits(limits ServerLimits) {
+	server.admission = newAdmission(limits)
+}
@@ -0,0 +1,220 @@
+package goRPC
+
+import (
+	"context"
+	"goRPC/codec"
+	"log"
+	"sync"
+)
+
+// Batch 批量调用：多个调用一次性发送，服务端执行完整批后一次性回复，每个调用有自己的结果和错误。
+// 批量中的每个调用仍然有独立的序列号，不支持批量调用的旧服务端会把它们当作普通调用逐个回复
+type Batch struct {
+	client   *Client
+	calls    []*Call
+	parallel bool
+}
+
+// Batch 创建一个批量调用
+func (client *Client) Batch() *Batch {
+	return &Batch{client: client}
+}
+
+// Add 加入一个调用，返回的 Call 在 Do 返回后保存该调用的结果
+func (b *Batch) Add(serviceMethod string, args, reply interface{}) *Call {
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Parallel 允许服务端并发执行批量中的调用，默认按加入的顺序逐个执行
+func (b *Batch) Parallel() *Batch {
+	b.parallel = true
+	return b
+}
+
+// Len 返回批量中的调用数量
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Do 发送批量调用并等待全部结果，ctx 携带的元数据随每个调用发送。
+// 返回第一个失败的调用的错误，每个调用的错误保存在各自的 Call.Error 中；
+// ctx 结束时放弃等待，尚未完成的调用的错误为 ctx 的错误。
+// 配置了 MaxInFlight 且 pending 位置不足时，先发送已经占到位置的调用再等待，
+// 此时批量会被拆成多次发送；超过 maxBatchSize 个调用的批量同样会被拆开
+func (b *Batch) Do(ctx context.Context) error {
+	if len(b.calls) == 0 {
+		return nil
+	}
+	client := b.client
+	done := make(chan *Call, len(b.calls))
+	metadata := MetadataFromContext(ctx)
+	sent := make([]*Call, 0, len(b.calls))
+	admitted := make([]*Call, 0, len(b.calls))
+	for _, call := range b.calls {
+		call.Done = done
+		call.Metadata = metadata
+		err := client.takeToken(ctx)
+		if err == nil && !client.trySlot() {
+			// 等待的位置可能被本批量中尚未发送的调用占用，先把它们发出去
+			if len(admitted) > 0 {
+				client.sendBatch(admitted, b.parallel)
+				sent = append(sent, admitted...)
+				admitted = admitted[len(admitted):]
+			}
+			err = client.takeSlot(ctx)
+		}
+		if err != nil {
+			call.Error = err
+			call.done()
+			continue
+		}
+		admitted = append(admitted, call)
+	}
+	client.sendBatch(admitted, b.parallel)
+	sent = append(sent, admitted...)
+
+	for n := 0; n < len(b.calls); n++ {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err := contextError(ctx.Err())
+			for _, call := range sent {
+				if client.removeCall(call.Sequence) != nil {
+					call.Error = err
+				}
+			}
+			return err
+		}
+	}
+	for _, call := range b.calls {
+		if call.Error != nil {
+			return call.Error
+		}
+	}
+	return nil
+}
+
+// 服务端执行之前要缓存整批请求，单个批量最多包含 maxBatchSize 个请求，更大的批量由客户端拆开发送
+const maxBatchSize = 1024
+
+// 按 maxBatchSize 拆分后依次发送
+func (client *Client) sendBatch(calls []*Call, parallel bool) {
+	for len(calls) > maxBatchSize {
+		client.writeBatch(calls[:maxBatchSize], parallel)
+		calls = calls[maxBatchSize:]
+	}
+	client.writeBatch(calls, parallel)
+}
+
+// 注册全部调用后把请求一次性写入连接，每个请求头都带有批量的大小
+func (client *Client) writeBatch(calls []*Call, parallel bool) {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+
+	headers := make([]codec.Header, 0, len(calls))
+	sent := make([]*Call, 0, len(calls))
+	for _, call := range calls {
+		seq, err := client.registerCall(call)
+		if err != nil {
+			call.Error = err
+			call.done()
+			continue
+		}
+		headers = append(headers, codec.Header{
+			ServiceMethod: call.ServiceMethod,
+			Sequence:      seq,
+			Metadata:      call.Metadata,
+			Parallel:      parallel,
+		})
+		sent = append(sent, call)
+	}
+	if len(sent) == 0 {
+		return
+	}
+	hs := make([]*codec.Header, len(sent))
+	bodies := make([]interface{}, len(sent))
+	for i := range headers {
+		headers[i].Batch = uint32(len(sent))
+		hs[i] = &headers[i]
+		bodies[i] = sent[i].Args
+	}
+	if err := codec.WriteBatch(client.cc, hs, bodies); err != nil {
+		for _, call := range sent {
+			if client.removeCall(call.Sequence) != nil {
+				call.Error = unavailable(err)
+				call.done()
+			}
+		}
+	}
+}
+
+// 读取批量调用中剩余的请求，全部读完后交给 handleBatch 执行。
+// first 是已经读到的第一个请求，firstErr 是读取它时的错误；返回 false 表示连接已经不可用
+func (server *Server) readBatch(cc codec.Codec, first *request, firstErr error, connLimiter *limiter, sending *sync.Mutex, wg *sync.WaitGroup) bool {
+	n := int(first.h.Batch)
+	var reqs []*request
+	var errs []error
+	req, err := first, firstErr
+	for {
+		if err == nil {
+			req.release, err = server.admission.admit(connLimiter, req.h.ServiceMethod)
+		}
+		reqs = append(reqs, req)
+		errs = append(errs, err)
+		if len(reqs) == n {
+			break
+		}
+		if req, err = server.readRequest(cc); req == nil {
+			for i, r := range reqs {
+				if errs[i] == nil {
+					r.release()
+				}
+				putRequest(r)
+			}
+			return false
+		}
+		req.callback = first.callback
+	}
+	wg.Add(1)
+	server.dispatch(serverTask{server: server, cc: cc, batch: reqs, errs: errs, sending: sending, wg: wg})
+	return true
+}
+
+// 执行批量中的请求，第一个请求头设置了 Parallel 时并发执行，全部完成后一次性回复。
+// 启用了协程池时整个批量占用一个协程，按顺序执行，不再额外创建协程
+func (server *Server) handleBatch(cc codec.Codec, reqs []*request, errs []error, sending *sync.Mutex, wg *sync.WaitGroup) {
+	defer wg.Done()
+	hs := make([]*codec.Header, len(reqs))
+	bodies := make([]interface{}, len(reqs))
+	parallel := reqs[0].h.Parallel && server.workers.Load() == nil
+	var calls sync.WaitGroup
+	for i, req := range reqs {
+		hs[i] = req.h
+		if errs[i] != nil {
+			setHeaderError(req.h, errs[i])
+			bodies[i] = invalidRequest
+			continue
+		}
+		if !parallel {
+			bodies[i] = server.invoke(req)
+			continue
+		}
+		calls.Add(1)
+		go func(i int, req *request) {
+			defer calls.Done()
+			bodies[i] = server.invoke(req)
+		}(i, req)
+	}
+	calls.Wait()
+
+	sending.Lock()
+	if err := codec.WriteBatch(cc, hs, bodies); err != nil {
+		log.Println("rpc server: write batch response error:", err)
+	}
+	sending.Unlock()
+	for _, req := range reqs {
+		putRequest(req)
+	}
+}
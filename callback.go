@@ -0,0 +1,153 @@
+package goRPC
+
+import (
+	"context"
+	"goRPC/codec"
+	"log"
+	"sync"
+)
+
+// Callback 服务端通过客户端建立的连接反向调用客户端注册的方法，适用于客户端无法接受入站连接的场景。
+// 反向调用的请求和响应都设置了 Header.Reverse，序列号与客户端发起的调用互不干扰
+type Callback struct {
+	cc      codec.Codec
+	sending *sync.Mutex // 与服务端回复共用的写锁
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*Call
+	closed  bool
+	done    chan struct{} // 连接断开时关闭
+}
+
+type callbackCtx struct{}
+
+// CallbackFromContext 取出发起当前请求的连接对应的 Callback，方法需要接收 context.Context 才能使用
+func CallbackFromContext(ctx context.Context) (*Callback, bool) {
+	cb, ok := ctx.Value(callbackCtx{}).(*Callback)
+	return cb, ok
+}
+
+func newCallback(cc codec.Codec, sending *sync.Mutex) *Callback {
+	return &Callback{cc: cc, sending: sending, pending: make(map[uint64]*Call), done: make(chan struct{})}
+}
+
+// Call 调用客户端注册的方法并等待结果，ctx 结束时放弃等待。
+// 不支持反向调用的旧客户端会丢弃请求，调用方应该为 ctx 设置超时
+func (cb *Callback) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: make(chan *Call, 1)}
+	cb.mu.Lock()
+	if cb.closed {
+		cb.mu.Unlock()
+		return ErrShutdown
+	}
+	cb.seq++
+	call.Sequence = cb.seq
+	cb.pending[call.Sequence] = call
+	cb.mu.Unlock()
+
+	if err := cb.write(ctx, call, false); err != nil {
+		if cb.remove(call.Sequence) != nil {
+			return unavailable(err)
+		}
+	}
+	select {
+	case <-ctx.Done():
+		cb.remove(call.Sequence)
+		return contextError(ctx.Err())
+	case <-call.Done:
+		return call.Error
+	}
+}
+
+// Notify 单向调用客户端注册的方法，例如推送进度，请求写入连接后立即返回
+func (cb *Callback) Notify(ctx context.Context, serviceMethod string, args interface{}) error {
+	cb.mu.Lock()
+	closed := cb.closed
+	cb.mu.Unlock()
+	if closed {
+		return ErrShutdown
+	}
+	if err := cb.write(ctx, &Call{ServiceMethod: serviceMethod, Args: args}, true); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+func (cb *Callback) write(ctx context.Context, call *Call, oneWay bool) error {
+	h := &codec.Header{
+		ServiceMethod: call.ServiceMethod,
+		Sequence:      call.Sequence,
+		Metadata:      MetadataFromContext(ctx),
+		OneWay:        oneWay,
+		Reverse:       true,
+	}
+	cb.sending.Lock()
+	defer cb.sending.Unlock()
+	return cb.cc.Write(h, call.Args)
+}
+
+func (cb *Callback) remove(seq uint64) *Call {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	call := cb.pending[seq]
+	delete(cb.pending, seq)
+	return call
+}
+
+// 读取客户端对反向调用的响应
+func (cb *Callback) receive(h *codec.Header) error {
+	return readReply(cb.cc, h, cb.remove(h.Sequence))
+}
+
+// 关闭连接，服务端读取请求的循环随之退出
+func (cb *Callback) close() {
+	_ = cb.cc.Close()
+}
+
+// 连接断开时结束所有等待中的反向调用
+func (cb *Callback) terminate() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.closed = true
+	close(cb.done)
+	for seq, call := range cb.pending {
+		delete(cb.pending, seq)
+		call.Error = ErrShutdown
+		call.done()
+	}
+}
+
+// Register 注册一个可以被服务端反向调用的服务，要求与 Server.Register 相同
+func (client *Client) Register(rcvr interface{}) error {
+	return client.callbacks.Register(rcvr)
+}
+
+// 读取服务端发来的反向调用请求，在新的协程中执行方法并回复
+func (client *Client) serveCallback(h *codec.Header) {
+	req := requestPool.Get().(*request)
+	*req.h = *h
+	if err := client.callbacks.readRequestBody(client.cc, req); err != nil {
+		setHeaderError(req.h, err)
+		client.sendCallbackResponse(req.h, invalidRequest)
+		putRequest(req)
+		return
+	}
+	go func() {
+		client.sendCallbackResponse(req.h, client.callbacks.invoke(req))
+		putRequest(req)
+	}()
+}
+
+func (client *Client) sendCallbackResponse(h *codec.Header, body interface{}) {
+	if h.OneWay {
+		if h.Error != "" {
+			log.Println("rpc client: one-way callback", h.ServiceMethod, "error:", h.Error)
+		}
+		return
+	}
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	if err := client.cc.Write(h, body); err != nil {
+		log.Println("rpc client: write callback response error:", err)
+	}
+}
@@ -1,6 +1,7 @@
 package goRPC
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,16 +10,21 @@ import (
 	"log"
 	"net"
 	"sync"
-	"time"
 )
 
 type Call struct {
 	ServiceMethod string
 	Sequence      uint64
 	Error         error
-	Args          interface{} // 传递给方法的参数
-	Reply         interface{} // 存储远程方法返回的结果
-	Done          chan *Call  // 回调函数，在RPC调用完成时通知调用者
+	Args          interface{}       // 传递给方法的参数
+	Reply         interface{}       // 存储远程方法返回的结果
+	Metadata      map[string]string // 随请求发送的元数据
+	Done          chan *Call        // 回调函数，在RPC调用完成时通知调用者
+}
+
+// 同步调用使用的 Call 和 Done 通道可以复用，减少每次调用的内存分配
+var callPool = sync.Pool{
+	New: func() interface{} { return &Call{Done: make(chan *Call, 1)} },
 }
 
 // 当调用结束时，会调用 call.done() 通知调用方，支持异步调用
@@ -31,21 +37,29 @@ func (call *Call) done() {
 
 // Client 结构体，代表一个RPC客户端
 type Client struct {
-	cc       codec.Codec      // 用于编码和解码
-	opt      *Option          // 客户端配置
-	sending  sync.Mutex       // 互斥锁，用于保护写操作，确保同一时间只有一个goroutine可以发送请求
-	header   codec.Header     // 存储RPC请求的头部信息
-	mu       sync.Mutex       // 另一个互斥锁，用于保护客户端的状态字段
-	Sequence uint64           // 序列号，用于唯一标识每个RPC请求。
-	pending  map[uint64]*Call // pending 存储未处理完的请求, 键是编号, 值是 Call 实例
-	closing  bool             // 表示用户是否主动关闭了客户端
-	shutdown bool             // 服务端或客户端发生错误。服务器是否通知客户端关闭
+	cc        codec.Codec              // 用于编码和解码
+	opt       *Option                  // 客户端配置
+	sending   sync.Mutex               // 互斥锁，用于保护写操作，确保同一时间只有一个goroutine可以发送请求
+	header    codec.Header             // 存储RPC请求的头部信息
+	mu        sync.Mutex               // 另一个互斥锁，用于保护客户端的状态字段
+	Sequence  uint64                   // 序列号，用于唯一标识每个RPC请求。
+	pending   map[uint64]*Call         // pending 存储未处理完的请求, 键是编号, 值是 Call 实例
+	closing   bool                     // 表示用户是否主动关闭了客户端
+	shutdown  bool                     // 服务端或客户端发生错误。服务器是否通知客户端关闭
+	broken    chan struct{}            // receive 退出、连接不再可用时关闭
+	limiter   *TokenBucket             // 发送速率限制，nil 表示不限制
+	slots     chan struct{}            // 每个 pending 中的调用占用一个位置，nil 表示不限制
+	codecs    []codec.Type             // 协商时服务端支持的编解码方式，没有协商时为 nil
+	callbacks *Server                  // 可以被服务端反向调用的服务
+	subMu     sync.Mutex               // 保护 handlers 和 messages
+	handlers  map[string]func(Message) // 订阅的主题和处理函数
+	messages  chan *Message            // 服务端推送、等待 handler 处理的消息
 }
 
 // 确保 Client 实现了 io.Closer 接口
 var _ io.Closer = (*Client)(nil)
 
-var ErrShutdown = errors.New("client shutdown")
+var ErrShutdown = NewError(Unavailable, "client shutdown")
 
 // Close 用于关闭客户端，通过设置 closing 字段为 true，并关闭编解码器
 func (client *Client) Close() error {
@@ -66,6 +80,23 @@ func (client *Client) IsAvailable() bool {
 	return !client.closing && !client.shutdown
 }
 
+// CodecType 返回连接实际使用的编解码方式
+func (client *Client) CodecType() codec.Type {
+	return client.opt.CodecType
+}
+
+// ServerCodecs 返回协商时服务端声明支持的全部编解码方式，没有设置 Option.Accept 时为 nil
+func (client *Client) ServerCodecs() []codec.Type {
+	return client.codecs
+}
+
+// Pending 返回已经发送、尚未收到响应的调用数量
+func (client *Client) Pending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pending)
+}
+
 // 将一个新的RPC调用注册到客户端。 将参数 call 添加到 client.pending 中，并更新 client.seq
 func (client *Client) registerCall(call *Call) (uint64, error) {
 	log.Println("start add call")
@@ -73,6 +104,7 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	if client.closing || client.shutdown {
+		client.releaseSlot()
 		return 0, ErrShutdown
 	}
 	call.Sequence = client.Sequence
@@ -86,10 +118,77 @@ func (client *Client) removeCall(seq uint64) *Call {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	call := client.pending[seq]
-	delete(client.pending, seq)
+	if call != nil {
+		delete(client.pending, seq)
+		client.releaseSlot()
+	}
 	return call
 }
 
+// 按限流配置获取发送许可：先从令牌桶取令牌，再占用一个 pending 位置。
+// FailFast 时超过限制立即返回错误，否则等待直到 ctx 结束
+func (client *Client) admit(ctx context.Context) error {
+	if err := client.takeToken(ctx); err != nil {
+		return err
+	}
+	return client.takeSlot(ctx)
+}
+
+// 占用一个 pending 位置，没有配置 MaxInFlight 时直接返回
+func (client *Client) takeSlot(ctx context.Context) error {
+	if client.slots == nil {
+		return nil
+	}
+	if client.opt.Limits.FailFast {
+		select {
+		case client.slots <- struct{}{}:
+			return nil
+		default:
+			return ErrTooManyInFlight
+		}
+	}
+	select {
+	case client.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+// 不等待地占用一个 pending 位置，返回是否成功
+func (client *Client) trySlot() bool {
+	if client.slots == nil {
+		return true
+	}
+	select {
+	case client.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// 从令牌桶取一个令牌，没有配置 QPS 时直接返回
+func (client *Client) takeToken(ctx context.Context) error {
+	if client.limiter == nil {
+		return nil
+	}
+	if client.opt.Limits.FailFast {
+		if !client.limiter.Allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	return client.limiter.Wait(ctx)
+}
+
+// 释放一个 pending 位置，调用方需要持有 client.mu
+func (client *Client) releaseSlot() {
+	if client.slots != nil {
+		<-client.slots
+	}
+}
+
 // 终止所有挂起的RPC调用，客户端关闭或遇到无法恢复的错误时调用
 // 将 shutdown 设置为 true，遍历所有挂起的调用，且将错误信息通知所有 pending 状态的 call。
 func (client *Client) terminateCall(err error) {
@@ -98,45 +197,72 @@ func (client *Client) terminateCall(err error) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	client.shutdown = true
-	for _, call := range client.pending {
-		call.Error = err
+	close(client.broken)
+	for seq, call := range client.pending {
+		delete(client.pending, seq)
+		client.releaseSlot()
+		call.Error = unavailable(err)
 		call.done()
 	}
 }
 
+// 根据响应头重建服务端返回的 *Error，旧版本服务端没有错误码时视为 Unknown
+func headerError(h *codec.Header) *Error {
+	code := Code(h.Code)
+	if code == OK {
+		code = Unknown
+	}
+	return &Error{Code: code, Message: h.Error, Details: h.Details}
+}
+
 /*
 接收到的响应有三种可能：
 call 不存在： 可能是请求没有发送完整
 call 存在但服务端处理异常：h.Error 非空
 call 存在且服务端处理正常：读取body中的reply的值
 */
+func readReply(cc codec.Codec, h *codec.Header, call *Call) error {
+	var err error
+	switch {
+	// call不存在
+	case call == nil:
+		err = cc.ReadBody(nil)
+	// 服务端处理异常
+	case h.Error != "" || h.Code != uint32(OK):
+		call.Error = headerError(h)
+		err = cc.ReadBody(nil)
+		call.done()
+	// 正常，读取reply
+	default:
+		err = cc.ReadBody(call.Reply)
+		if err != nil {
+			call.Error = NewError(Internal, "read body error: "+err.Error())
+		}
+		call.done()
+	}
+	return err
+}
+
+// 循环读取响应，设置了 Reverse 的是服务端发来的反向调用请求
 func (client *Client) receive() {
 	log.Println("start receive")
 	defer log.Println("end receive")
 	var err error
+	var h codec.Header
 	for err == nil {
-		var h codec.Header
+		h = codec.Header{}
 		if err = client.cc.ReadHeader(&h); err != nil {
 			break
 		}
-		call := client.removeCall(h.Sequence)
-		switch {
-		// call不存在
-		case call == nil:
-			err = client.cc.ReadBody(nil)
-		// 服务端处理异常
-		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
-			err = client.cc.ReadBody(nil)
-			call.done()
-		// 正常，读取reply
-		default:
-			err = client.cc.ReadBody(call.Reply)
-			if err != nil {
-				call.Error = errors.New("read body error" + err.Error())
+		if h.Reverse {
+			if h.ServiceMethod == pubsubDeliver {
+				err = client.deliver()
+			} else {
+				client.serveCallback(&h)
 			}
-			call.done()
+			continue
 		}
+		err = readReply(client.cc, &h, client.removeCall(h.Sequence))
 	}
 	client.terminateCall(err)
 }
@@ -159,11 +285,15 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Sequence = seq
 	client.header.Error = ""
+	client.header.Code = 0
+	client.header.Details = nil
+	client.header.Metadata = call.Metadata
+	client.header.OneWay = false
 
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
 		call := client.removeCall(seq)
 		if call != nil {
-			call.Error = err
+			call.Error = unavailable(err)
 			call.done()
 		}
 	}
@@ -172,6 +302,11 @@ func (client *Client) send(call *Call) {
 // Go 实现异步调用RPC服务
 // 调用者可以通过 done 通道接收回调通知，了解调用是否完成
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return client.goContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+// 配置了限流时，在发送之前等待许可，ctx 用于结束等待
+func (client *Client) goContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	log.Println("start Go")
 	defer log.Println("end Go")
 	if done == nil {
@@ -179,25 +314,95 @@ func (client *Client) Go(serviceMethod string, args, reply interface{}, done cha
 	} else if cap(done) == 0 {
 		log.Panic("client don't have any done channel")
 	}
-	call := &Call{
-		ServiceMethod: serviceMethod,
-		Args:          args,
-		Reply:         reply,
-		Done:          done,
+	call := &Call{Done: done}
+	client.start(ctx, call, serviceMethod, args, reply)
+	return call
+}
+
+// 填充 call 并在获得许可后发送
+func (client *Client) start(ctx context.Context, call *Call, serviceMethod string, args, reply interface{}) {
+	call.ServiceMethod = serviceMethod
+	call.Args = args
+	call.Reply = reply
+	call.Metadata = MetadataFromContext(ctx)
+	if err := client.admit(ctx); err != nil {
+		call.Error = err
+		call.done()
+		return
 	}
 	client.send(call)
+}
 
-	return call
+// Notify 发起单向调用：服务端执行方法但不回复，调用不进入 pending，
+// 请求写入连接后立即返回，返回的错误只表示发送失败
+func (client *Client) Notify(serviceMethod string, args interface{}) error {
+	return client.NotifyContext(context.Background(), serviceMethod, args)
+}
+
+// NotifyContext 带 context 的单向调用，ctx 携带的元数据随请求发送，配置了限流时 ctx 用于结束等待
+func (client *Client) NotifyContext(ctx context.Context, serviceMethod string, args interface{}) error {
+	if err := client.takeToken(ctx); err != nil {
+		return err
+	}
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	if !client.IsAvailable() {
+		return ErrShutdown
+	}
+	client.header.ServiceMethod = serviceMethod
+	client.header.Sequence = 0
+	client.header.Error = ""
+	client.header.Code = 0
+	client.header.Details = nil
+	client.header.Metadata = MetadataFromContext(ctx)
+	client.header.OneWay = true
+	if err := client.cc.Write(&client.header, args); err != nil {
+		return unavailable(err)
+	}
+	return nil
 }
 
 // Call 是 Go 方法的同步版本
 // 等待 done 通道接收到完成通知，然后返回调用的错误状态
 func (client *Client) Call(serviceMethod string, args, reply interface{}) error {
+	return client.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext 带 context 的同步调用，ctx 结束时放弃等待并从 pending 中移除该调用。
+// 配置了重试策略时，失败的幂等调用会按策略重试，连接已经关闭时不再重试
+func (client *Client) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
 	log.Println("start call")
 	defer log.Println("end call")
 
-	call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
-	return call.Error
+	if client.opt.Retry == nil {
+		return client.call(ctx, serviceMethod, args, reply)
+	}
+	return client.opt.Retry.do(ctx, serviceMethod, func(int) error {
+		return client.call(ctx, serviceMethod, args, reply)
+	}, client.IsAvailable)
+}
+
+// 发起一次调用并等待结果，Call 从 callPool 中获取，
+// 只有确定没有其他协程再引用它时才放回：收到了结果，或者已经从 pending 中移除
+func (client *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := callPool.Get().(*Call)
+	client.start(ctx, call, serviceMethod, args, reply)
+	select {
+	case <-ctx.Done():
+		if client.removeCall(call.Sequence) != nil {
+			putCall(call)
+		}
+		return contextError(ctx.Err())
+	case <-call.Done:
+		err := call.Error
+		putCall(call)
+		return err
+	}
+}
+
+func putCall(call *Call) {
+	*call = Call{Done: call.Done}
+	callPool.Put(call)
 }
 
 // 解析客户端配置选项
@@ -221,10 +426,20 @@ func parseOptions(opts ...*Option) (*Option, error) {
 // 启动 receive Goroutine，负责接收来自服务端的响应。
 func NewClientCode(codec codec.Codec, opt *Option) *Client {
 	client := &Client{
-		opt:      opt,
-		cc:       codec,
-		pending:  make(map[uint64]*Call),
-		Sequence: 1,
+		opt:       opt,
+		cc:        codec,
+		pending:   make(map[uint64]*Call),
+		Sequence:  1,
+		broken:    make(chan struct{}),
+		callbacks: &Server{}, // 不注册健康检查和反射服务，服务端只能调用客户端显式注册的服务
+	}
+	if limits := opt.Limits; limits != nil {
+		if limits.QPS > 0 {
+			client.limiter = NewTokenBucket(limits.QPS, limits.Burst)
+		}
+		if limits.MaxInFlight > 0 {
+			client.slots = make(chan struct{}, limits.MaxInFlight)
+		}
 	}
 	log.Println("start client receive")
 	defer log.Println("end client receive")
@@ -239,8 +454,11 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 	log.Println("starting new client")
 	defer log.Println("finished new client")
 
-	f := codec.NewCodecFuncMap[opt.CodecType]
-	if f == nil {
+	if len(opt.Accept) > 0 {
+		return negotiateClient(conn, opt)
+	}
+	f, ok := codec.Lookup(opt.CodecType)
+	if !ok {
 		err := fmt.Errorf("codec type error %s", opt.CodecType)
 		log.Println(err)
 		return nil, err
@@ -252,7 +470,48 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 		_ = conn.Close()
 		return nil, err
 	}
-	return NewClientCode(f(conn), opt), nil
+	return NewClientCode(f(clientConn(conn, opt)), opt), nil
+}
+
+// 配置了 Flush 时在连接和编解码器之间加入合并写的缓冲层
+func clientConn(conn io.ReadWriteCloser, opt *Option) io.ReadWriteCloser {
+	if opt.Flush == nil {
+		return conn
+	}
+	return newFlushConn(conn, opt.Flush)
+}
+
+// 发送 Option 后读取服务端回复的 Handshake，使用服务端选中的编解码方式创建 Client
+func negotiateClient(conn net.Conn, opt *Option) (*Client, error) {
+	if err := json.NewEncoder(conn).Encode(opt); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	var hs Handshake
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&hs); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("rpc client: read handshake error: %w", err)
+	}
+	if hs.Error != "" {
+		_ = conn.Close()
+		// 把服务端支持的编解码方式放在 Details 中，errors.Is(err, ErrCodecNotSupported) 仍然成立
+		details := make([]string, len(hs.Codecs))
+		for i, t := range hs.Codecs {
+			details[i] = string(t)
+		}
+		return nil, NewError(Unimplemented, ErrCodecNotSupported.Message, details...)
+	}
+	f, ok := codec.Lookup(hs.CodecType)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("codec type error %s", hs.CodecType)
+	}
+	negotiated := *opt
+	negotiated.CodecType = hs.CodecType
+	client := NewClientCode(f(clientConn(newHandshakeConn(dec, conn), opt)), &negotiated)
+	client.codecs = hs.Codecs
+	return client, nil
 }
 
 // Dial 连接RPC服务器
@@ -266,7 +525,6 @@ func Dial(network, addr string, opts ...*Option) (client *Client, err error) {
 		return nil, err
 	}
 
-	time.Sleep(time.Second)
 	conn, err := net.Dial(network, addr)
 	if err != nil {
 		return nil, err
@@ -280,3 +538,15 @@ func Dial(network, addr string, opts ...*Option) (client *Client, err error) {
 	log.Println("create client")
 	return NewClient(conn, opt)
 }
+
+// Caller 支持带 context 同步调用的客户端，Client、ReconnectClient、ClientPool 都实现了该接口，
+// gorpc-gen 生成的类型安全客户端基于它发起调用
+type Caller interface {
+	CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error
+}
+
+var (
+	_ Caller = (*Client)(nil)
+	_ Caller = (*ReconnectClient)(nil)
+	_ Caller = (*ClientPool)(nil)
+)
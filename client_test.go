@@ -0,0 +1,640 @@
+package goRPC
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goRPC/codec"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Bar int
+
+func (b Bar) Fail(args string, reply *int) error {
+	return NewError(InvalidArgument, "bad value 100%", args)
+}
+
+type Slow int
+
+func (s Slow) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	return nil
+}
+
+// 启动一个注册了 Foo、Bar 和 Slow 的服务端，返回监听地址
+func startTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	var foo Foo
+	var bar Bar
+	var slow Slow
+	server := NewServer()
+	_ = server.Register(&foo)
+	_ = server.Register(&bar)
+	_ = server.Register(&slow)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return server, l.Addr().String()
+}
+
+func TestClient_TypedError(t *testing.T) {
+	_, addr := startTestServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call("Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call Foo.Sum fail: %v", err)
+
+	err = client.Call("Baz.Sum", Args{}, &reply)
+	var e *Error
+	_assert(errors.As(err, &e) && e.Code == NotFound, "expect NotFound, got %v", err)
+	_assert(e.Message == "service not found: Baz", "unexpected message %q", e.Message)
+	_assert(errors.Is(err, ErrServiceNotFound) && !errors.Is(err, ErrMethodNotFound), "expect ErrServiceNotFound, got %v", err)
+
+	err = client.Call("Foo.Mul", Args{}, &reply)
+	_assert(ErrorCode(err) == NotFound, "expect NotFound, got %v", err)
+	_assert(errors.Is(err, ErrMethodNotFound) && !errors.Is(err, ErrServiceNotFound), "expect ErrMethodNotFound, got %v", err)
+
+	err = client.Call("FooSum", Args{}, &reply)
+	_assert(ErrorCode(err) == InvalidArgument && errors.Is(err, ErrInvalidServiceMethod), "expect ErrInvalidServiceMethod, got %v", err)
+
+	err = client.Call("Bar.Fail", "detail", &reply)
+	_assert(errors.As(err, &e) && e.Code == InvalidArgument, "expect InvalidArgument, got %v", err)
+	_assert(e.Message == "bad value 100%", "message mangled: %q", e.Message)
+	_assert(len(e.Details) == 1 && e.Details[0] == "detail", "unexpected details %v", e.Details)
+	_assert(errors.Is(err, &Error{Code: InvalidArgument}), "errors.Is by code fail")
+}
+
+// trackListener 记录所有接受的连接，用于模拟服务端重启
+type trackListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackListener) shutdown() {
+	_ = l.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+}
+
+func serveOn(t *testing.T, addr string) *trackListener {
+	t.Helper()
+	var foo Foo
+	server := NewServer()
+	_ = server.Register(&foo)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := &trackListener{Listener: l}
+	t.Cleanup(tl.shutdown)
+	go server.Accept(tl)
+	return tl
+}
+
+func TestReconnectClient(t *testing.T) {
+	l := serveOn(t, "127.0.0.1:0")
+	addr := l.Addr().String()
+	policy := &ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+	rc, err := DialReconnect("tcp", addr, policy)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = rc.Close() }()
+
+	var reply int
+	err = rc.Call("Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call before restart fail: %v", err)
+
+	l.shutdown()
+	for rc.IsAvailable() {
+		time.Sleep(time.Millisecond)
+	}
+	serveOn(t, addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = rc.CallContext(ctx, "Foo.Sum", Args{Num1: 2, Num2: 2}, &reply)
+	_assert(err == nil && reply == 4, "call after restart fail: %v", err)
+}
+
+func TestClientPool(t *testing.T) {
+	l := serveOn(t, "127.0.0.1:0")
+	addr := l.Addr().String()
+	policy := &ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+	pool, err := DialPool("tcp", addr, 3, policy)
+	_assert(err == nil && pool.Size() == 3, "dial pool error: %v", err)
+	defer func() { _ = pool.Close() }()
+
+	callAll := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var reply int
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				err := pool.CallContext(ctx, "Foo.Sum", Args{Num1: i, Num2: i}, &reply)
+				_assert(err == nil && reply == 2*i, "pool call %d fail: %v", i, err)
+			}(i)
+		}
+		wg.Wait()
+	}
+	callAll()
+
+	l.shutdown()
+	for pool.IsAvailable() {
+		time.Sleep(time.Millisecond)
+	}
+	serveOn(t, addr)
+	callAll()
+	_assert(pool.Pending() == 0, "pending calls left: %d", pool.Pending())
+}
+
+func TestClient_Limits(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	client, err := Dial("tcp", addr, &Option{Limits: &ClientLimits{MaxInFlight: 2, FailFast: true}})
+	_assert(err == nil, "dial error: %v", err)
+	var reply int
+	calls := []*Call{
+		client.Go("Slow.Sleep", 100*time.Millisecond, new(int), nil),
+		client.Go("Slow.Sleep", 100*time.Millisecond, new(int), nil),
+	}
+	err = client.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+	_assert(errors.Is(err, ErrTooManyInFlight), "expect ErrTooManyInFlight, got %v", err)
+	for _, call := range calls {
+		<-call.Done
+		_assert(call.Error == nil, "slow call fail: %v", call.Error)
+	}
+	err = client.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+	_assert(err == nil && reply == 2, "call after slots released fail: %v", err)
+	_ = client.Close()
+
+	client, err = Dial("tcp", addr, &Option{Limits: &ClientLimits{MaxInFlight: 1}})
+	_assert(err == nil, "dial error: %v", err)
+	slowCall := client.Go("Slow.Sleep", 50*time.Millisecond, new(int), nil)
+	err = client.Call("Foo.Sum", Args{Num1: 2, Num2: 2}, &reply)
+	_assert(err == nil && reply == 4, "blocking call fail: %v", err)
+	_assert(len(slowCall.Done) == 1, "blocking call must wait for the in-flight call")
+	_ = client.Close()
+
+	client, err = Dial("tcp", addr, &Option{Limits: &ClientLimits{QPS: 1, Burst: 1, FailFast: true}})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	_assert(client.Call("Foo.Sum", Args{}, &reply) == nil, "first call must pass the rate limiter")
+	err = client.Call("Foo.Sum", Args{}, &reply)
+	_assert(errors.Is(err, ErrRateLimited), "expect ErrRateLimited, got %v", err)
+}
+
+type Echo int
+
+func (e Echo) Metadata(ctx context.Context, key string, reply *string) error {
+	*reply = MetadataFromContext(ctx)[key]
+	return nil
+}
+
+func TestClient_CodecsWithMetadata(t *testing.T) {
+	server, addr := startTestServer(t)
+	var echo Echo
+	_ = server.Register(&echo)
+	for _, ct := range []codec.Type{codec.JsonType, codec.MsgpackType, codec.CborType} {
+		client, err := Dial("tcp", addr, &Option{CodecType: ct})
+		_assert(err == nil, "dial error: %v", err)
+
+		var reply int
+		err = client.Call("Foo.Sum", Args{Num1: 2, Num2: 5}, &reply)
+		_assert(err == nil && reply == 7, "%s call fail: %v", ct, err)
+		err = client.Call("Foo.Mul", Args{}, &reply)
+		_assert(ErrorCode(err) == NotFound, "%s: expect NotFound, got %v", ct, err)
+		err = client.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+		_assert(err == nil && reply == 2, "%s call after error fail: %v", ct, err)
+
+		var user string
+		ctx := WithMetadata(context.Background(), map[string]string{"user": "alice"})
+		err = client.CallContext(ctx, "Echo.Metadata", "user", &user)
+		_assert(err == nil && user == "alice", "%s metadata call fail: %v %q", ct, err, user)
+		_ = client.Close()
+	}
+}
+
+// Counter 记录收到的单向调用
+type Counter struct{ n atomic.Int64 }
+
+func (c *Counter) Add(n int, reply *int) error {
+	c.n.Add(int64(n))
+	return nil
+}
+
+func TestClient_Notify(t *testing.T) {
+	server, addr := startTestServer(t)
+	var counter Counter
+	_ = server.Register(&counter)
+	for _, ct := range []codec.Type{codec.JobType, codec.JsonType, codec.ProtoType, codec.MsgpackType, codec.CborType} {
+		counter.n.Store(0)
+		client, err := Dial("tcp", addr, &Option{CodecType: ct})
+		_assert(err == nil, "dial error: %v", err)
+		for i := 1; i <= 10; i++ {
+			_assert(client.Notify("Counter.Add", i) == nil, "%s notify fail", ct)
+		}
+		_assert(client.Notify("Counter.Missing", 1) == nil, "%s notify unknown method must not fail locally", ct)
+		_assert(client.Pending() == 0, "%s: notify must not be pending", ct)
+
+		// 单向调用失败不会回复，连接上的普通调用不受影响
+		var reply int
+		err = client.Call("Counter.Add", 0, &reply)
+		_assert(err == nil, "%s call after notify fail: %v", ct, err)
+		for deadline := time.Now().Add(time.Second); counter.n.Load() != 55 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		_assert(counter.n.Load() == 55, "%s: expect 55, got %d", ct, counter.n.Load())
+		_ = client.Close()
+		_assert(errors.Is(client.Notify("Counter.Add", 1), ErrShutdown), "%s: expect ErrShutdown after close", ct)
+	}
+}
+
+func TestClient_Batch(t *testing.T) {
+	_, addr := startTestServer(t)
+	for _, ct := range []codec.Type{codec.JobType, codec.JsonType, codec.MsgpackType, codec.CborType} {
+		client, err := Dial("tcp", addr, &Option{CodecType: ct})
+		_assert(err == nil, "dial error: %v", err)
+
+		var sum, sum2 int
+		b := client.Batch()
+		sumCall := b.Add("Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+		failCall := b.Add("Bar.Fail", "x", new(int))
+		missing := b.Add("Foo.Missing", Args{}, new(int))
+		sum2Call := b.Add("Foo.Sum", Args{Num1: 3, Num2: 4}, &sum2)
+		err = b.Do(context.Background())
+		_assert(ErrorCode(err) == InvalidArgument, "%s: expect first error InvalidArgument, got %v", ct, err)
+		_assert(sumCall.Error == nil && sum == 3, "%s sum fail: %v %d", ct, sumCall.Error, sum)
+		_assert(ErrorCode(failCall.Error) == InvalidArgument, "%s: expect InvalidArgument, got %v", ct, failCall.Error)
+		_assert(ErrorCode(missing.Error) == NotFound, "%s: expect NotFound, got %v", ct, missing.Error)
+		_assert(sum2Call.Error == nil && sum2 == 7, "%s sum fail: %v %d", ct, sum2Call.Error, sum2)
+		_assert(client.Pending() == 0, "%s: batch calls must be done", ct)
+		_ = client.Close()
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	policy := DefaultRetryPolicy.MarkIdempotent("Foo.Sum")
+	_assert(policy.Idempotent["Foo.Sum"] && DefaultRetryPolicy.Idempotent == nil, "MarkIdempotent must not modify the shared policy")
+
+	_, addr := startTestServer(t)
+	client, err := Dial("tcp", addr, &Option{Retry: policy})
+	_assert(err == nil, "dial error: %v", err)
+	_ = client.Close()
+
+	// 连接已经关闭，重试不会成功，应该立即返回而不是等待退避
+	start := time.Now()
+	err = client.Call("Foo.Sum", Args{Num1: 1, Num2: 2}, new(int))
+	_assert(errors.Is(err, ErrShutdown), "expect ErrShutdown, got %v", err)
+	_assert(time.Since(start) < policy.InitialBackoff, "closed client must not retry, took %v", time.Since(start))
+}
+
+func TestClient_BatchMaxInFlight(t *testing.T) {
+	_, addr := startTestServer(t)
+	client, err := Dial("tcp", addr, &Option{Limits: &ClientLimits{MaxInFlight: 2}})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	// 批量大于 MaxInFlight 时分多次发送，不能等待本批量自己占用的位置
+	b := client.Batch()
+	sums := make([]int, 5)
+	for i := range sums {
+		b.Add("Foo.Sum", Args{Num1: i, Num2: i}, &sums[i])
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- b.Do(context.Background()) }()
+	select {
+	case err = <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("batch larger than MaxInFlight must not block")
+	}
+	_assert(err == nil, "batch fail: %v", err)
+	for i, sum := range sums {
+		_assert(sum == 2*i, "expect %d, got %d", 2*i, sum)
+	}
+	_assert(client.Pending() == 0, "batch calls must be done")
+}
+
+func TestClient_BatchSize(t *testing.T) {
+	_, addr := startTestServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	// 超过上限的批量由客户端拆开发送
+	b := client.Batch()
+	sums := make([]int, maxBatchSize+1)
+	for i := range sums {
+		b.Add("Foo.Sum", Args{Num1: i, Num2: 1}, &sums[i])
+	}
+	err = b.Do(context.Background())
+	_assert(err == nil && sums[maxBatchSize] == maxBatchSize+1, "large batch fail: %v", err)
+
+	// 服务端不缓存声明了超大批量的请求，直接拒绝
+	call := &Call{ServiceMethod: "Foo.Sum", Args: Args{Num1: 1, Num2: 2}, Reply: new(int), Done: make(chan *Call, 1)}
+	seq, err := client.registerCall(call)
+	_assert(err == nil, "register call fail: %v", err)
+	h := &codec.Header{ServiceMethod: call.ServiceMethod, Sequence: seq, Batch: maxBatchSize + 1}
+	client.sending.Lock()
+	err = codec.WriteBatch(client.cc, []*codec.Header{h}, []interface{}{call.Args})
+	client.sending.Unlock()
+	_assert(err == nil, "write fail: %v", err)
+	select {
+	case <-call.Done:
+	case <-time.After(time.Second):
+		t.Fatal("oversized batch must be rejected")
+	}
+	_assert(ErrorCode(call.Error) == ResourceExhausted, "expect ResourceExhausted, got %v", call.Error)
+}
+
+func TestClient_BatchParallel(t *testing.T) {
+	_, addr := startTestServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	b := client.Batch().Parallel()
+	for i := 0; i < 5; i++ {
+		b.Add("Slow.Sleep", 100*time.Millisecond, new(int))
+	}
+	start := time.Now()
+	err = b.Do(context.Background())
+	_assert(err == nil && time.Since(start) < 300*time.Millisecond, "parallel batch fail: %v, took %v", err, time.Since(start))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	b = client.Batch()
+	call := b.Add("Slow.Sleep", 200*time.Millisecond, new(int))
+	err = b.Do(ctx)
+	_assert(ErrorCode(err) == DeadlineExceeded && ErrorCode(call.Error) == DeadlineExceeded, "expect DeadlineExceeded, got %v %v", err, call.Error)
+}
+
+// Task 服务端方法，执行时通过反向调用向客户端报告进度
+type Task int
+
+func (Task) Run(ctx context.Context, steps int, reply *int) error {
+	cb, ok := CallbackFromContext(ctx)
+	if !ok {
+		return errors.New("no callback")
+	}
+	for i := 1; i <= steps; i++ {
+		if err := cb.Notify(ctx, "Progress.Report", i); err != nil {
+			return err
+		}
+	}
+	return cb.Call(ctx, "Progress.Double", steps, reply)
+}
+
+// Progress 注册在客户端、由服务端反向调用的服务
+type Progress struct{ reported atomic.Int64 }
+
+func (p *Progress) Report(step int, reply *int) error {
+	p.reported.Add(1)
+	return nil
+}
+
+func (p *Progress) Double(n int, reply *int) error {
+	*reply = n * 2
+	return nil
+}
+
+func TestClient_Callback(t *testing.T) {
+	server, addr := startTestServer(t)
+	var task Task
+	_ = server.Register(&task)
+	for _, ct := range []codec.Type{codec.JobType, codec.JsonType, codec.ProtoType, codec.MsgpackType, codec.CborType} {
+		client, err := Dial("tcp", addr, &Option{CodecType: ct})
+		_assert(err == nil, "dial error: %v", err)
+		var progress Progress
+		_assert(client.Register(&progress) == nil, "register callback service fail")
+		_, ok := client.callbacks.serviceMap.Load("Health")
+		_assert(!ok, "client must not expose built-in services to callbacks")
+
+		var reply int
+		err = client.Call("Task.Run", 5, &reply)
+		_assert(err == nil && reply == 10, "%s callback fail: %v, reply %d", ct, err, reply)
+		// 单向的进度通知与普通调用一样并发执行，不保证在 Task.Run 返回前完成
+		for deadline := time.Now().Add(time.Second); progress.reported.Load() != 5 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		_assert(progress.reported.Load() == 5, "%s: expect 5 reports, got %d", ct, progress.reported.Load())
+		_ = client.Close()
+	}
+
+	// 客户端没有注册服务时，反向调用返回 NotFound
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	err = client.Call("Task.Run", 1, new(int))
+	_assert(ErrorCode(err) == NotFound, "expect NotFound, got %v", err)
+}
+
+// 协商测试使用的自定义编码，注册表是全局的，在 TestMain 中只注册一次
+const testCodecType codec.Type = "application/x-test-json"
+
+func TestMain(m *testing.M) {
+	if err := codec.Register(testCodecType, codec.NewJsonCodec); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestClient_NegotiateCodec(t *testing.T) {
+	custom := testCodecType
+	_, addr := startTestServer(t)
+
+	client, err := Dial("tcp", addr, &Option{Accept: []codec.Type{"application/x-missing", custom, codec.JobType}})
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	_assert(client.CodecType() == custom, "expect %s, got %s", custom, client.CodecType())
+	advertised := make(map[codec.Type]bool)
+	for _, ct := range client.ServerCodecs() {
+		advertised[ct] = true
+	}
+	_assert(advertised[custom] && advertised[codec.CborType], "server codecs %v", client.ServerCodecs())
+	var reply int
+	err = client.Call("Foo.Sum", Args{Num1: 3, Num2: 4}, &reply)
+	_assert(err == nil && reply == 7, "call over negotiated codec fail: %v", err)
+
+	_, err = Dial("tcp", addr, &Option{Accept: []codec.Type{"application/x-missing"}})
+	var e *Error
+	_assert(errors.Is(err, ErrCodecNotSupported) && errors.As(err, &e), "expect ErrCodecNotSupported, got %v", err)
+	_assert(len(e.Details) == len(client.ServerCodecs()), "expect supported codecs in details, got %v", e.Details)
+}
+
+func TestClient_Flush(t *testing.T) {
+	addr := startLimitedServer(t, ServerLimits{})
+	client, err := Dial("tcp", addr, &Option{Flush: &FlushPolicy{MaxDelay: time.Millisecond, MaxBytes: 256}})
+	_assert(err == nil, "dial error: %v", err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply int
+			err := client.Call("Foo.Sum", Args{Num1: i, Num2: 1}, &reply)
+			_assert(err == nil && reply == i+1, "call %d fail: %v, reply %d", i, err, reply)
+		}(i)
+	}
+	wg.Wait()
+
+	_ = client.Close()
+	err = client.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, new(int))
+	_assert(errors.Is(err, ErrShutdown), "expect ErrShutdown after close, got %v", err)
+}
+
+func TestFlushConn_Close(t *testing.T) {
+	local, remote := net.Pipe()
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(remote)
+		received <- data
+	}()
+
+	// 写入成功的数据在 Close 之前即使还没有发送也必须写入连接
+	c := newFlushConn(local, &FlushPolicy{MaxDelay: time.Second})
+	var want []byte
+	for i := 0; i < 100; i++ {
+		p := []byte(fmt.Sprintf("message %d;", i))
+		_, err := c.Write(p)
+		_assert(err == nil, "write error: %v", err)
+		want = append(want, p...)
+	}
+	_ = c.Close()
+	_assert(string(<-received) == string(want), "buffered data lost on close")
+	_, err := c.Write([]byte("x"))
+	_assert(err != nil, "write after close must fail")
+}
+
+func TestFlushConn_CloseBlocked(t *testing.T) {
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+
+	// 对端从不读取，Close 不能一直阻塞在写连接上
+	c := newFlushConn(local, &FlushPolicy{})
+	_, err := c.Write([]byte("never read"))
+	_assert(err == nil, "write error: %v", err)
+	closed := make(chan struct{})
+	go func() {
+		_ = c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * flushCloseTimeout):
+		t.Fatal("close blocked on a peer that never reads")
+	}
+}
+
+// 统计客户端写连接的次数，用于观察合并写的效果
+type countingConn struct {
+	net.Conn
+	writes int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(p)
+}
+
+// 关闭日志后测量一次同步调用的耗时和内存分配，包括客户端和服务端，workers > 0 时服务端使用协程池。
+// writes/op 是平均每次调用写连接的次数
+func benchmarkCall(b *testing.B, opt *Option, workers int, parallel bool) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	var foo Foo
+	server := NewServer()
+	_ = server.Register(&foo)
+	server.SetWorkers(workers)
+	defer server.SetWorkers(0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn := &countingConn{Conn: nc}
+	if opt, err = parseOptions(opt); err != nil {
+		b.Fatal(err)
+	}
+	client, err := NewClient(conn, opt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := atomic.LoadInt64(&conn.writes)
+	defer func() {
+		b.ReportMetric(float64(atomic.LoadInt64(&conn.writes)-start)/float64(b.N), "writes/op")
+	}()
+	if !parallel {
+		var reply int
+		for i := 0; i < b.N; i++ {
+			if err := client.Call("Foo.Sum", Args{Num1: i, Num2: 1}, &reply); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return
+	}
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		var reply int
+		for pb.Next() {
+			if err := client.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkClient_Call(b *testing.B) {
+	for _, ct := range []codec.Type{codec.JobType, codec.JsonType, codec.MsgpackType, codec.CborType} {
+		b.Run(string(ct[len("application/"):]), func(b *testing.B) { benchmarkCall(b, &Option{CodecType: ct}, 0, false) })
+	}
+	b.Run("job-workers", func(b *testing.B) { benchmarkCall(b, &Option{}, 4, false) })
+}
+
+func BenchmarkClient_CallParallel(b *testing.B) {
+	b.Run("goroutines", func(b *testing.B) { benchmarkCall(b, &Option{}, 0, true) })
+	b.Run("workers", func(b *testing.B) { benchmarkCall(b, &Option{}, 64, true) })
+	b.Run("flush", func(b *testing.B) { benchmarkCall(b, &Option{Flush: &FlushPolicy{}}, 64, true) })
+	b.Run("flush-delay", func(b *testing.B) {
+		benchmarkCall(b, &Option{Flush: &FlushPolicy{MaxDelay: 50 * time.Microsecond}}, 64, true)
+	})
+}
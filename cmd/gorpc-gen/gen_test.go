@@ -0,0 +1,67 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const source = `package demo
+
+import (
+	"context"
+	t "time"
+)
+
+type Args struct{ Num1, Num2 int }
+
+type Foo int
+
+func (f Foo) Sum(args Args, reply *int) error { return nil }
+
+func (f *Foo) Wait(ctx context.Context, d t.Duration, reply *[]string) error { return nil }
+
+func (f Foo) sum(args Args, reply *int) error { return nil }
+
+func (f Foo) NoReply(args Args, reply int) error { return nil }
+
+func (f Foo) String() string { return "" }
+`
+
+func TestGenerate(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "demo.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := collect(fset, []*ast.File{f}, "Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Methods) != 2 || spec.Methods[0].Name != "Sum" || spec.Methods[1].Name != "Wait" {
+		t.Fatalf("unexpected methods %+v", spec.Methods)
+	}
+	src, err := render(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		"package demo",
+		`t "time"`,
+		"func (c *FooClient) Sum(ctx context.Context, args Args) (int, error)",
+		"func (c *FooClient) Wait(ctx context.Context, args t.Duration) ([]string, error)",
+		`c.c.CallContext(ctx, "Foo.Wait", args, &reply)`,
+		"func RegisterFoo(server *goRPC.Server, svc *Foo) error",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code missing %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := collect(fset, []*ast.File{f}, "Bar"); err == nil {
+		t.Error("expect error for unknown type")
+	}
+}
@@ -0,0 +1,84 @@
+// gorpc-gen 为 goRPC 服务生成类型安全的客户端和注册函数，配合 go generate 使用：
+//
+//	//go:generate go run goRPC/cmd/gorpc-gen -type Foo
+//
+// 读取当前目录下的 Go 源码，找到类型 Foo 上所有可以被 goRPC 调用的方法，
+// 生成 foo_rpc.go，其中包含 FooClient 和 RegisterFoo。
+// 生成的 FooClient.Sum(ctx, args) 直接返回方法的 reply 类型，参数或返回值类型不匹配会在编译时报错。
+//
+// 也可以从 IDL 文件生成消息类型、服务端接口和客户端，语法见 goRPC/idl：
+//
+//	//go:generate go run goRPC/cmd/gorpc-gen -idl demo.idl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"goRPC/idl"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gorpc-gen: ")
+	typeName := flag.String("type", "", "name of the service type, required")
+	idlFile := flag.String("idl", "", "generate from an IDL file instead of Go source")
+	output := flag.String("output", "", "output file name, default <type>_rpc.go or <idl>_rpc.go")
+	flag.Parse()
+	if *idlFile != "" {
+		generateIDL(*idlFile, *output)
+		return
+	}
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	spec, err := parseService(dir, *typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := render(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := *output
+	if name == "" {
+		name = strings.ToLower(*typeName) + "_rpc.go"
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("gorpc-gen: wrote %s with %d methods\n", filepath.Join(dir, name), len(spec.Methods))
+}
+
+// 解析 IDL 文件，生成的代码写到 IDL 文件所在的目录
+func generateIDL(file, output string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := idl.Parse(string(data))
+	if err != nil {
+		log.Fatalf("%s:%v", file, err)
+	}
+	src, err := idl.Generate(f, filepath.Base(file))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if output == "" {
+		output = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + "_rpc.go"
+	}
+	name := filepath.Join(filepath.Dir(file), output)
+	if err := os.WriteFile(name, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("gorpc-gen: wrote %s with %d messages and %d services\n", name, len(f.Messages), len(f.Services))
+}
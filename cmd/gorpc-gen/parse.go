@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// serviceSpec 从源码中解析出的服务描述
+type serviceSpec struct {
+	Package string
+	Name    string
+	Methods []methodSpec
+	Imports []importSpec // 参数和返回值类型引用的包
+}
+
+// methodSpec 一个可以被远程调用的方法
+type methodSpec struct {
+	Name      string
+	ArgType   string // 参数类型的源码
+	ReplyType string // 返回值指针指向的类型的源码
+}
+
+type importSpec struct {
+	Name string // 别名，与包路径最后一段相同时为空
+	Path string
+}
+
+// 解析 dir 下的非测试、非生成文件
+func parseService(dir, typeName string) (*serviceSpec, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && !strings.HasSuffix(fi.Name(), "_rpc.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		files := make([]*ast.File, 0, len(pkg.Files))
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+		if spec, err := collect(fset, files, typeName); err == nil {
+			return spec, nil
+		}
+	}
+	return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+}
+
+// collect 在 files 中查找类型 typeName 及其方法。
+// 与 service.registerMethod 的规则一致：导出的方法，参数为 (args, *reply) 或 (context.Context, args, *reply)，返回 error
+func collect(fset *token.FileSet, files []*ast.File, typeName string) (*serviceSpec, error) {
+	spec := &serviceSpec{Name: typeName}
+	found := false
+	imports := make(map[string]importSpec)
+	for _, f := range files {
+		if f.Scope.Lookup(typeName) != nil {
+			found = true
+			spec.Package = f.Name.Name
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || !fn.Name.IsExported() || receiverName(fn.Recv) != typeName {
+				continue
+			}
+			m, ok := methodFromDecl(fset, fn)
+			if !ok {
+				continue
+			}
+			spec.Methods = append(spec.Methods, m)
+			for _, expr := range []ast.Expr{paramType(fn, -2), paramType(fn, -1)} {
+				for name, imp := range referencedImports(f, expr) {
+					imports[name] = imp
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("type %s not found", typeName)
+	}
+	sort.Slice(spec.Methods, func(i, j int) bool { return spec.Methods[i].Name < spec.Methods[j].Name })
+	for _, imp := range imports {
+		spec.Imports = append(spec.Imports, imp)
+	}
+	sort.Slice(spec.Imports, func(i, j int) bool { return spec.Imports[i].Path < spec.Imports[j].Path })
+	return spec, nil
+}
+
+// 接收者的类型名，T 和 *T 都返回 T
+func receiverName(recv *ast.FieldList) string {
+	if len(recv.List) != 1 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// 把参数列表展开成每个参数一个类型，i 为负数时从末尾开始取
+func paramType(fn *ast.FuncDecl, i int) ast.Expr {
+	var types []ast.Expr
+	for _, field := range fn.Type.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			types = append(types, field.Type)
+		}
+	}
+	if i < 0 {
+		i += len(types)
+	}
+	if i < 0 || i >= len(types) {
+		return nil
+	}
+	return types[i]
+}
+
+func methodFromDecl(fset *token.FileSet, fn *ast.FuncDecl) (methodSpec, bool) {
+	n := fn.Type.Params.NumFields()
+	if n != 2 && n != 3 {
+		return methodSpec{}, false
+	}
+	if n == 3 && exprString(fset, paramType(fn, 0)) != "context.Context" {
+		return methodSpec{}, false
+	}
+	results := fn.Type.Results
+	if results == nil || results.NumFields() != 1 || exprString(fset, results.List[0].Type) != "error" {
+		return methodSpec{}, false
+	}
+	reply, ok := paramType(fn, -1).(*ast.StarExpr)
+	if !ok {
+		return methodSpec{}, false
+	}
+	return methodSpec{
+		Name:      fn.Name.Name,
+		ArgType:   exprString(fset, paramType(fn, -2)),
+		ReplyType: exprString(fset, reply.X),
+	}, true
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// 找出类型表达式中 pkg.Type 形式引用的包，返回包名到 import 的映射
+func referencedImports(f *ast.File, expr ast.Expr) map[string]importSpec {
+	used := make(map[string]importSpec)
+	if expr == nil {
+		return used
+	}
+	ast.Inspect(expr, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		for _, imp := range f.Imports {
+			p, _ := strconv.Unquote(imp.Path.Value)
+			name := path.Base(p)
+			alias := ""
+			if imp.Name != nil {
+				name, alias = imp.Name.Name, imp.Name.Name
+			}
+			if name == ident.Name {
+				used[name] = importSpec{Name: alias, Path: p}
+			}
+		}
+		return true
+	})
+	return used
+}
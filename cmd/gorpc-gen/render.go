@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"text/template"
+)
+
+var stubTemplate = template.Must(template.New("stub").Parse(`// Code generated by gorpc-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- if ne .Package "goRPC"}}
+	"goRPC"
+{{- end}}
+{{- range .Imports}}
+	{{if .Name}}{{.Name}} {{end}}"{{.Path}}"
+{{- end}}
+)
+
+{{$rpc := "goRPC."}}{{if eq .Package "goRPC"}}{{$rpc = ""}}{{end -}}
+// {{.Name}}Client 是 {{.Name}} 服务的类型安全客户端
+type {{.Name}}Client struct {
+	c {{$rpc}}Caller
+}
+
+// New{{.Name}}Client 使用任意 {{$rpc}}Caller 创建 {{.Name}}Client，例如 *goRPC.Client、*goRPC.ClientPool
+func New{{.Name}}Client(c {{$rpc}}Caller) *{{.Name}}Client {
+	return &{{.Name}}Client{c: c}
+}
+{{range .Methods}}
+// {{.Name}} 调用 {{$.Name}}.{{.Name}}
+func (c *{{$.Name}}Client) {{.Name}}(ctx context.Context, args {{.ArgType}}) ({{.ReplyType}}, error) {
+	var reply {{.ReplyType}}
+	err := c.c.CallContext(ctx, "{{$.Name}}.{{.Name}}", args, &reply)
+	return reply, err
+}
+{{end}}
+// Register{{.Name}} 把 {{.Name}} 注册到 server
+func Register{{.Name}}(server *{{$rpc}}Server, svc *{{.Name}}) error {
+	return server.Register(svc)
+}
+`))
+
+// render 生成客户端代码并格式化
+func render(spec *serviceSpec) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := stubTemplate.Execute(&buf, spec); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
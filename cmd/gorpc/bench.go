@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"goRPC"
+	"goRPC/codec"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// benchStats 一个压测协程的统计结果，结束后合并
+type benchStats struct {
+	latencies []time.Duration
+	errors    map[string]int // 键是错误码
+}
+
+func (s *benchStats) merge(o *benchStats) {
+	s.latencies = append(s.latencies, o.latencies...)
+	for code, n := range o.errors {
+		s.errors[code] += n
+	}
+}
+
+// 压测参数：args 为 nil 时说明需要根据服务端的类型描述构造参数
+type benchTarget struct {
+	serviceMethod string
+	args          interface{}
+	newReply      func() interface{}
+}
+
+func runBench(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("bench", &common)
+	concurrency := fs.Int("c", 10, "number of concurrent callers")
+	conns := fs.Int("conns", 1, "number of connections shared by the callers")
+	qps := fs.Float64("qps", 0, "total requests per second, 0 means unlimited")
+	duration := fs.Duration("d", 10*time.Second, "benchmark duration")
+	payload := fs.Int("payload", 0, "send a random []byte of this size as args instead of json-args")
+	codecName := fs.String("codec", "json", "codec used by the connections, e.g. json, gob or a full codec type")
+	_ = fs.Parse(args)
+	if fs.NArg() < 2 || fs.NArg() > 3 || *concurrency <= 0 || *conns <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	addr, serviceMethod := fs.Arg(0), fs.Arg(1)
+	ct := codecType(*codecName)
+
+	target, err := newBenchTarget(addr, serviceMethod, fs.Arg(2), *payload, ct, &common)
+	if err != nil {
+		return err
+	}
+	clients := make([]*goRPC.Client, *conns)
+	for i := range clients {
+		if clients[i], err = dial(addr, ct, &common); err != nil {
+			return err
+		}
+		defer func(c *goRPC.Client) { _ = c.Close() }(clients[i])
+	}
+	var limiter *goRPC.TokenBucket
+	if *qps > 0 {
+		limiter = goRPC.NewTokenBucket(*qps, 1)
+	}
+
+	fmt.Printf("benchmarking %s on %s: codec=%s concurrency=%d conns=%d qps=%v duration=%v\n",
+		serviceMethod, addr, ct, *concurrency, *conns, *qps, *duration)
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	total := &benchStats{errors: make(map[string]int)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(client *goRPC.Client) {
+			defer wg.Done()
+			stats := benchWorker(ctx, client, limiter, target, common.timeout)
+			mu.Lock()
+			total.merge(stats)
+			mu.Unlock()
+		}(clients[i%len(clients)])
+	}
+	wg.Wait()
+	report(total, time.Since(start))
+	return nil
+}
+
+// 构造压测参数：指定了 payload 时发送随机字节，否则 JSON 编解码器直接发送原始 JSON，
+// 其他编解码器借助 Reflection 构造与服务端结构相同的类型
+func newBenchTarget(addr, serviceMethod, jsonArgs string, payload int, ct codec.Type, common *commonFlags) (*benchTarget, error) {
+	target := &benchTarget{serviceMethod: serviceMethod}
+	if jsonArgs == "" {
+		jsonArgs = "{}"
+	}
+	if payload > 0 {
+		buf := make([]byte, payload)
+		_, _ = rand.Read(buf)
+		target.args = buf
+	}
+	if ct == codec.JsonType {
+		if target.args == nil {
+			if !json.Valid([]byte(jsonArgs)) {
+				return nil, fmt.Errorf("args is not valid JSON: %s", jsonArgs)
+			}
+			target.args = json.RawMessage(jsonArgs)
+		}
+		target.newReply = func() interface{} { return new(json.RawMessage) }
+		return target, nil
+	}
+
+	var desc goRPC.MethodDesc
+	req := goRPC.DescribeMethodRequest{ServiceMethod: serviceMethod}
+	if err := invoke(addr, goRPC.ReflectionServiceName+".DescribeMethod", req, &desc, nil, common); err != nil {
+		return nil, err
+	}
+	var err error
+	if target.args == nil {
+		if target.args, err = dynamicArgs(&desc, jsonArgs); err != nil {
+			return nil, err
+		}
+	}
+	target.newReply, err = dynamicReply(&desc)
+	return target, err
+}
+
+// 压测协程：不断发起调用直到 ctx 结束或连接断开，记录每次调用的延迟和错误码
+func benchWorker(ctx context.Context, client *goRPC.Client, limiter *goRPC.TokenBucket, target *benchTarget, timeout time.Duration) *benchStats {
+	stats := &benchStats{errors: make(map[string]int)}
+	reply := target.newReply()
+	var backoff time.Duration
+	for ctx.Err() == nil {
+		if limiter != nil && limiter.Wait(ctx) != nil {
+			break
+		}
+		callCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := client.CallContext(callCtx, target.serviceMethod, target.args, reply)
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			stats.errors[goRPC.ErrorCode(err).String()]++
+			// 连接已经断开，之后的调用都会立即失败
+			if !client.IsAvailable() {
+				break
+			}
+			// 服务端过载或暂时不可用时退避，避免空转
+			if code := goRPC.ErrorCode(err); code == goRPC.Unavailable || code == goRPC.ResourceExhausted {
+				backoff = min(max(2*backoff, 10*time.Millisecond), time.Second)
+				select {
+				case <-ctx.Done():
+				case <-time.After(backoff):
+				}
+			}
+			continue
+		}
+		backoff = 0
+		stats.latencies = append(stats.latencies, elapsed)
+	}
+	return stats
+}
+
+// 输出吞吐量、延迟分位数和错误分布
+func report(stats *benchStats, elapsed time.Duration) {
+	success := len(stats.latencies)
+	failed := 0
+	for _, n := range stats.errors {
+		failed += n
+	}
+	fmt.Printf("requests: %d  success: %d  errors: %d  elapsed: %v\n", success+failed, success, failed, elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput: %.1f req/s\n", float64(success+failed)/elapsed.Seconds())
+	if success > 0 {
+		sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+		var sum time.Duration
+		for _, l := range stats.latencies {
+			sum += l
+		}
+		fmt.Printf("latency: min=%v mean=%v max=%v\n", stats.latencies[0], sum/time.Duration(success), stats.latencies[success-1])
+		for _, p := range []float64{50, 90, 95, 99, 99.9} {
+			fmt.Printf("  p%-5v %v\n", p, percentile(stats.latencies, p))
+		}
+	}
+	if failed > 0 {
+		codes := make([]string, 0, len(stats.errors))
+		for code := range stats.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		fmt.Println("errors:")
+		for _, code := range codes {
+			fmt.Printf("  %-20s %d\n", code, stats.errors[code])
+		}
+	}
+}
+
+// 已排序延迟的第 p 百分位
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
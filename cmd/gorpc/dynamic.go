@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"goRPC"
+	"reflect"
+	"strings"
+)
+
+// 根据 Reflection 返回的类型描述构造等价的 Go 类型。
+// gob 按字段名匹配结构体，因此构造出的匿名结构体可以和服务端的类型互相编解码
+func typeFromDesc(d *goRPC.TypeDesc) (reflect.Type, error) {
+	if d.Ref {
+		return nil, fmt.Errorf("recursive type %s is not supported", d.Name)
+	}
+	switch d.Kind {
+	case "bool":
+		return reflect.TypeOf(false), nil
+	case "int":
+		return reflect.TypeOf(int(0)), nil
+	case "int8":
+		return reflect.TypeOf(int8(0)), nil
+	case "int16":
+		return reflect.TypeOf(int16(0)), nil
+	case "int32":
+		return reflect.TypeOf(int32(0)), nil
+	case "int64":
+		return reflect.TypeOf(int64(0)), nil
+	case "uint":
+		return reflect.TypeOf(uint(0)), nil
+	case "uint8":
+		return reflect.TypeOf(uint8(0)), nil
+	case "uint16":
+		return reflect.TypeOf(uint16(0)), nil
+	case "uint32":
+		return reflect.TypeOf(uint32(0)), nil
+	case "uint64":
+		return reflect.TypeOf(uint64(0)), nil
+	case "float32":
+		return reflect.TypeOf(float32(0)), nil
+	case "float64":
+		return reflect.TypeOf(float64(0)), nil
+	case "string":
+		return reflect.TypeOf(""), nil
+	case "ptr", "slice", "array", "map":
+		elem, err := typeFromDesc(d.Elem)
+		if err != nil {
+			return nil, err
+		}
+		switch d.Kind {
+		case "ptr":
+			return reflect.PointerTo(elem), nil
+		case "slice":
+			return reflect.SliceOf(elem), nil
+		case "array":
+			return reflect.ArrayOf(d.Len, elem), nil
+		}
+		key, err := typeFromDesc(d.Key)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, elem), nil
+	case "struct":
+		fields := make([]reflect.StructField, 0, len(d.Fields))
+		for _, f := range d.Fields {
+			t, err := typeFromDesc(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: t, Tag: reflect.StructTag(f.Tag)})
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, fmt.Errorf("unsupported kind %s of type %s", d.Kind, d.Name)
+}
+
+// 把 JSON 参数转换成方法参数类型的值
+func dynamicArgs(desc *goRPC.MethodDesc, args string) (interface{}, error) {
+	argType, err := typeFromDesc(desc.ArgType)
+	if err != nil {
+		return nil, err
+	}
+	argv := reflect.New(argType)
+	dec := json.NewDecoder(strings.NewReader(args))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(argv.Interface()); err != nil {
+		return nil, fmt.Errorf("decode args into %s: %w", desc.ArgType.Name, err)
+	}
+	return argv.Elem().Interface(), nil
+}
+
+// 返回创建 reply 的函数，每次返回一个指向返回值类型的新指针
+func dynamicReply(desc *goRPC.MethodDesc) (func() interface{}, error) {
+	replyType, err := typeFromDesc(desc.ReplyType)
+	if err != nil {
+		return nil, err
+	}
+	return func() interface{} { return reflect.New(replyType.Elem()).Interface() }, nil
+}
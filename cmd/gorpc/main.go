@@ -0,0 +1,260 @@
+// gorpc 是 goRPC 的命令行客户端，使用 JSON 编解码器调用任意服务，
+// 并借助服务端内置的 Reflection 服务列出服务和方法
+//
+//	gorpc call [-timeout 5s] [-md key=value]... addr Service.Method '{"json":"args"}'
+//	gorpc list [-timeout 5s] addr [prefix]
+//	gorpc describe [-timeout 5s] addr Service.Method
+//	gorpc codecs [-timeout 5s] addr
+//	gorpc bench [-c 10] [-qps 0] [-d 10s] [-payload 0] [-codec json] addr Service.Method ['{"json":"args"}']
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"goRPC"
+	"goRPC/codec"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// 子命令的用法说明，按展示顺序排列
+var usages = []struct{ name, usage string }{
+	{"call", "call [flags] addr Service.Method [json-args]"},
+	{"list", "list [flags] addr [prefix]"},
+	{"describe", "describe [flags] addr Service.Method"},
+	{"codecs", "codecs [flags] addr"},
+	{"bench", "bench [flags] addr Service.Method [json-args]"},
+}
+
+var commands = map[string]func(args []string) error{
+	"call":     runCall,
+	"list":     runList,
+	"describe": runDescribe,
+	"codecs":   runCodecs,
+	"bench":    runBench,
+}
+
+func usageOf(name string) string {
+	for _, u := range usages {
+		if u.name == name {
+			return u.usage
+		}
+	}
+	return name
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, u := range usages {
+		fmt.Fprintln(os.Stderr, "  gorpc", u.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := run(os.Args[2:]); err != nil {
+		var e *goRPC.Error
+		if errors.As(err, &e) {
+			fmt.Fprintf(os.Stderr, "error: code = %s desc = %s\n", e.Code, e.Message)
+			for _, d := range e.Details {
+				fmt.Fprintln(os.Stderr, "  detail:", d)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// metadataFlag 可以重复指定的 -md key=value 参数
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("metadata must be key=value, got %q", s)
+	}
+	m[k] = v
+	return nil
+}
+
+// 每个子命令共用的参数
+type commonFlags struct {
+	timeout time.Duration
+	verbose bool
+}
+
+func newFlagSet(name string, common *commonFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gorpc", usageOf(name))
+		fs.PrintDefaults()
+	}
+	fs.DurationVar(&common.timeout, "timeout", 5*time.Second, "dial and call timeout")
+	fs.BoolVar(&common.verbose, "v", false, "print goRPC debug logs")
+	return fs
+}
+
+// 把命令行中的编解码器名字转换成 codec.Type，"json" 对应 "application/json"，"gob" 对应 gob 编码的 codec.JobType
+func codecType(name string) codec.Type {
+	switch {
+	case name == "gob":
+		return codec.JobType
+	case strings.Contains(name, "/"):
+		return codec.Type(name)
+	default:
+		return codec.Type("application/" + name)
+	}
+}
+
+// 使用指定的编解码器连接服务端，默认关闭 goRPC 的调试日志
+func dial(addr string, ct codec.Type, common *commonFlags) (*goRPC.Client, error) {
+	return dialOption(addr, &goRPC.Option{MagicNumber: goRPC.MagicNumber, CodecType: ct}, common)
+}
+
+func dialOption(addr string, opt *goRPC.Option, common *commonFlags) (*goRPC.Client, error) {
+	if !common.verbose {
+		log.SetOutput(io.Discard)
+	}
+	conn, err := net.DialTimeout("tcp", addr, common.timeout)
+	if err != nil {
+		return nil, err
+	}
+	// 旧版本或没有响应的服务端不会完成握手，握手期间使用同样的超时
+	_ = conn.SetDeadline(time.Now().Add(common.timeout))
+	client, err := goRPC.NewClient(conn, opt)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return client, nil
+}
+
+// 发起一次调用，参数和返回值都是原始的 JSON
+func invoke(addr, serviceMethod string, args interface{}, reply interface{}, md map[string]string, common *commonFlags) error {
+	client, err := dial(addr, codec.JsonType, common)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), common.timeout)
+	defer cancel()
+	if len(md) > 0 {
+		ctx = goRPC.WithMetadata(ctx, md)
+	}
+	return client.CallContext(ctx, serviceMethod, args, reply)
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func runCall(args []string) error {
+	var common commonFlags
+	md := make(metadataFlag)
+	fs := newFlagSet("call", &common)
+	fs.Var(md, "md", "request metadata key=value, can be repeated")
+	_ = fs.Parse(args)
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	body := "{}"
+	if fs.NArg() == 3 {
+		body = fs.Arg(2)
+	}
+	if !json.Valid([]byte(body)) {
+		return fmt.Errorf("args is not valid JSON: %s", body)
+	}
+	var reply json.RawMessage
+	if err := invoke(fs.Arg(0), fs.Arg(1), json.RawMessage(body), &reply, md, &common); err != nil {
+		return err
+	}
+	return printJSON(reply)
+}
+
+func runList(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("list", &common)
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var reply goRPC.ListServicesResponse
+	req := goRPC.ListServicesRequest{Prefix: fs.Arg(1)}
+	if err := invoke(fs.Arg(0), goRPC.ReflectionServiceName+".ListServices", req, &reply, nil, &common); err != nil {
+		return err
+	}
+	for _, s := range reply.Services {
+		for _, m := range s.Methods {
+			fmt.Println(s.Name + "." + m)
+		}
+	}
+	return nil
+}
+
+func runDescribe(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("describe", &common)
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var reply goRPC.MethodDesc
+	req := goRPC.DescribeMethodRequest{ServiceMethod: fs.Arg(1)}
+	if err := invoke(fs.Arg(0), goRPC.ReflectionServiceName+".DescribeMethod", req, &reply, nil, &common); err != nil {
+		return err
+	}
+	return printJSON(reply)
+}
+
+// 通过握手协商列出服务端支持的编解码方式
+func runCodecs(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("codecs", &common)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opt := &goRPC.Option{MagicNumber: goRPC.MagicNumber, Accept: []codec.Type{codec.JsonType}}
+	client, err := dialOption(fs.Arg(0), opt, &common)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	for _, ct := range client.ServerCodecs() {
+		fmt.Println(ct)
+	}
+	return nil
+}
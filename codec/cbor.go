@@ -0,0 +1,472 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Cbor 是 Codec 接口基于 CBOR（RFC 8949）的实现，header 和 body 依次编码为两个 CBOR 数据项。
+// 编码遵循 RFC 8949 4.2.1 的核心确定性编码：整数、长度和浮点数使用最短形式，
+// 不使用不定长编码，map 的键按编码后的字节序排序，相同的值总是得到相同的字节，便于签名和哈希。
+// 结构体编码为以字段名为键的 map，字段名优先取 cbor 标签，其次是 json 标签；
+// time.Time 编码为标签 0 的 RFC 3339 字符串，时区统一为 UTC
+type Cbor struct {
+	conn    io.ReadWriteCloser
+	reader  *bufio.Reader
+	buff    *bufio.Writer
+	scratch []byte        // 复用的编码缓冲区
+	dec     *valueDecoder // 复用的解码器
+}
+
+var _ Codec = (*Cbor)(nil)
+
+func (c *Cbor) ReadHeader(h *Header) error {
+	return c.dec.decodeInto(h)
+}
+
+// ReadBody body 为 nil 时读取并丢弃一个数据项
+func (c *Cbor) ReadBody(body interface{}) error {
+	if body == nil {
+		_, err := c.dec.decodeAny()
+		return err
+	}
+	return c.dec.decodeInto(body)
+}
+
+func (c *Cbor) Write(h *Header, body interface{}) (err error) {
+	defer c.flush(&err)
+	return c.write(h, body)
+}
+
+func (c *Cbor) WriteBatch(hs []*Header, bodies []interface{}) (err error) {
+	defer c.flush(&err)
+	for i, h := range hs {
+		if err = c.write(h, bodies[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 刷新缓冲区，写入失败时关闭连接
+func (c *Cbor) flush(err *error) {
+	_ = c.buff.Flush()
+	if *err != nil {
+		_ = c.Close()
+	}
+}
+
+// 编码一条消息写入缓冲区，不刷新
+func (c *Cbor) write(h *Header, body interface{}) (err error) {
+	e := &cborEncoder{buf: c.scratch[:0]}
+	if err = e.encode(reflect.ValueOf(h)); err != nil {
+		log.Println("rpc codec: cbor error encoding header:", err)
+		return err
+	}
+	if err = e.encode(reflect.ValueOf(body)); err != nil {
+		log.Println("rpc codec: cbor error encoding body:", err)
+		return err
+	}
+	c.scratch = e.buf
+	_, err = c.buff.Write(e.buf)
+	return err
+}
+
+func (c *Cbor) Close() error {
+	return c.conn.Close()
+}
+
+// NewCborCodec 创建一个新的 CborCodec 实例
+func NewCborCodec(conn io.ReadWriteCloser) Codec {
+	reader := bufio.NewReader(conn)
+	return &Cbor{
+		conn:   conn,
+		reader: reader,
+		buff:   bufio.NewWriter(conn),
+		dec:    newCborDecoder(reader),
+	}
+}
+
+// MarshalCBOR 使用确定性编码把 v 编码为 CBOR
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	e := &cborEncoder{}
+	err := e.encode(reflect.ValueOf(v))
+	return e.buf, err
+}
+
+// UnmarshalCBOR 把 CBOR 解码到 v 指向的值
+func UnmarshalCBOR(data []byte, v interface{}) error {
+	return newCborDecoder(bytes.NewReader(data)).decodeInto(v)
+}
+
+// CBOR 的主类型
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+type cborEncoder struct {
+	buf []byte
+}
+
+// 写入主类型和参数，参数使用能容纳它的最短形式
+func (e *cborEncoder) head(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, major|26), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, major|27), n)
+	}
+}
+
+func (e *cborEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xf6)
+		return nil
+	}
+	if v.Type() == timeType {
+		e.head(cborTag, 0)
+		s := v.Interface().(time.Time).UTC().Format(time.RFC3339Nano)
+		e.head(cborText, uint64(len(s)))
+		e.buf = append(e.buf, s...)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xf6)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xf5)
+		} else {
+			e.buf = append(e.buf, 0xf4)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := v.Int(); n >= 0 {
+			e.head(cborUint, uint64(n))
+		} else {
+			e.head(cborNegInt, uint64(-1-n))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.encodeFloat(v.Float())
+	case reflect.String:
+		e.head(cborText, uint64(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, 0xf6)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.head(cborBytes, uint64(v.Len()))
+			e.buf = append(e.buf, bytesOf(v)...)
+			return nil
+		}
+		e.head(cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xf6)
+			return nil
+		}
+		iter := v.MapRange()
+		entries := make([]cborEntry, 0, v.Len())
+		for iter.Next() {
+			entries = append(entries, cborEntry{key: iter.Key(), value: iter.Value()})
+		}
+		return e.encodeEntries(entries)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("rpc codec: cbor cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+// cborField 结构体字段及其编码后的名字，按编码后的名字排序后缓存
+type cborField struct {
+	fieldInfo
+	key []byte
+}
+
+var cborFieldsCache sync.Map // reflect.Type -> []cborField
+
+func cborFields(t reflect.Type) []cborField {
+	if f, ok := cborFieldsCache.Load(t); ok {
+		return f.([]cborField)
+	}
+	var fields []cborField
+	for _, f := range cachedFields(t, "cbor") {
+		ke := &cborEncoder{}
+		ke.head(cborText, uint64(len(f.name)))
+		fields = append(fields, cborField{fieldInfo: f, key: append(ke.buf, f.name...)})
+	}
+	slices.SortFunc(fields, func(a, b cborField) int { return bytes.Compare(a.key, b.key) })
+	f, _ := cborFieldsCache.LoadOrStore(t, fields)
+	return f.([]cborField)
+}
+
+// 结构体的字段顺序是固定的，直接使用缓存中排好序的字段
+func (e *cborEncoder) encodeStruct(v reflect.Value) error {
+	fields := cborFields(v.Type())
+	n := 0
+	for _, f := range fields {
+		if !f.omitEmpty || !isEmptyValue(v.FieldByIndex(f.index)) {
+			n++
+		}
+	}
+	e.head(cborMap, uint64(n))
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		e.buf = append(e.buf, f.key...)
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cborEntry struct {
+	key, value reflect.Value
+	encoded    []byte // 编码后的键，用于排序
+}
+
+var errDuplicateKey = errors.New("rpc codec: cbor duplicate map key")
+
+// 先单独编码每个键，按编码后的字节序排序后再依次写入键和值
+func (e *cborEncoder) encodeEntries(entries []cborEntry) error {
+	for i := range entries {
+		ke := &cborEncoder{}
+		if err := ke.encode(entries[i].key); err != nil {
+			return err
+		}
+		entries[i].encoded = ke.buf
+	}
+	slices.SortFunc(entries, func(a, b cborEntry) int {
+		return bytes.Compare(a.encoded, b.encoded)
+	})
+	e.head(cborMap, uint64(len(entries)))
+	for i, entry := range entries {
+		// 例如值相同的两个 interface{} 键
+		if i > 0 && bytes.Equal(entry.encoded, entries[i-1].encoded) {
+			return errDuplicateKey
+		}
+		e.buf = append(e.buf, entry.encoded...)
+		if err := e.encode(entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 浮点数使用能精确表示该值的最短形式，NaN 统一编码为 0xf97e00
+func (e *cborEncoder) encodeFloat(f float64) {
+	if math.IsNaN(f) {
+		e.buf = append(e.buf, 0xf9, 0x7e, 0x00)
+		return
+	}
+	f32 := float32(f)
+	if float64(f32) != f {
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xfb), math.Float64bits(f))
+		return
+	}
+	if h, ok := float16Bits(f32); ok {
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xf9), h)
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xfa), math.Float32bits(f32))
+}
+
+// float16Bits 返回 f 的半精度表示，f 不能被半精度精确表示时返回 false
+func float16Bits(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff == 0: // ±0
+		return sign, true
+	case exp == 128: // ±Inf，NaN 已经单独处理
+		return sign | 0x7c00, mant == 0
+	case exp >= -14 && exp <= 15: // 规格化数，尾数只能有 10 位
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14: // 非规格化数
+		m := mant | 0x800000
+		shift := uint(-exp - 1)
+		if m&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(m>>shift), true
+	}
+	return 0, false
+}
+
+// float16 把半精度的位表示转换为 float64
+func float16(h uint16) float64 {
+	exp := int(h >> 10 & 0x1f)
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+var errInvalidCbor = errors.New("rpc codec: invalid cbor data")
+
+// cborReader 把 CBOR 数据切分成 token，不支持不定长编码
+type cborReader struct {
+	r    byteReader
+	buf  []byte // 复用的读缓冲区
+	tags int    // 当前标签的嵌套层数
+}
+
+func newCborDecoder(r byteReader) *valueDecoder {
+	return &valueDecoder{name: "cbor", tag: "cbor", next: (&cborReader{r: r}).next}
+}
+
+// 读取主类型和参数
+func (d *cborReader) head() (major byte, ai byte, n uint64, err error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, ai = c>>5, c&0x1f
+	switch {
+	case ai < 24:
+		return major, ai, uint64(ai), nil
+	case ai <= 27:
+		var buf [8]byte
+		size := 1 << (ai - 24)
+		if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+			return 0, 0, 0, unexpectedEOF(err)
+		}
+		return major, ai, binary.BigEndian.Uint64(buf[:]), nil
+	}
+	return 0, 0, 0, errInvalidCbor
+}
+
+func (d *cborReader) next() (token, error) {
+	major, ai, n, err := d.head()
+	if err != nil {
+		return token{}, err
+	}
+	switch major {
+	case cborUint:
+		return token{kind: kindUint, u: n}, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return token{}, errors.New("rpc codec: cbor integer overflow")
+		}
+		return token{kind: kindInt, i: -1 - int64(n)}, nil
+	case cborBytes, cborText:
+		data, err := readBytes(d.r, n, &d.buf)
+		kind := kindBinary
+		if major == cborText {
+			kind = kindString
+		}
+		return token{kind: kind, data: data}, err
+	case cborArray, cborMap:
+		if n > maxMessageSize {
+			return token{}, errMessageTooLarge
+		}
+		kind := kindArray
+		if major == cborMap {
+			kind = kindMap
+		}
+		return token{kind: kind, n: int(n)}, nil
+	case cborTag:
+		return d.tagged(n)
+	}
+	switch ai {
+	case 20, 21:
+		return token{kind: kindBool, b: ai == 21}, nil
+	case 22, 23: // null 和 undefined
+		return token{kind: kindNil}, nil
+	case 25:
+		return token{kind: kindFloat, f: float16(uint16(n))}, nil
+	case 26:
+		return token{kind: kindFloat, f: float64(math.Float32frombits(uint32(n)))}, nil
+	case 27:
+		return token{kind: kindFloat, f: math.Float64frombits(n)}, nil
+	}
+	return token{}, errInvalidCbor
+}
+
+// 标签 0 和 1 解码为时间，其余标签忽略，直接返回被标记的数据项
+func (d *cborReader) tagged(tag uint64) (token, error) {
+	if d.tags >= maxNestingDepth {
+		return token{}, errTooDeep
+	}
+	d.tags++
+	tok, err := d.next()
+	d.tags--
+	if err != nil {
+		return tok, unexpectedEOF(err)
+	}
+	switch {
+	case tag == 0 && tok.kind == kindString:
+		t, err := time.Parse(time.RFC3339Nano, string(tok.data))
+		return token{kind: kindTime, t: t.UTC()}, err
+	case tag == 1 && tok.kind == kindUint:
+		return token{kind: kindTime, t: time.Unix(int64(tok.u), 0).UTC()}, nil
+	case tag == 1 && tok.kind == kindInt:
+		return token{kind: kindTime, t: time.Unix(tok.i, 0).UTC()}, nil
+	case tag == 1 && tok.kind == kindFloat:
+		sec, frac := math.Modf(tok.f)
+		return token{kind: kindTime, t: time.Unix(int64(sec), int64(frac*1e9)).UTC()}, nil
+	case tag == 0 || tag == 1:
+		return tok, errInvalidCbor
+	}
+	return tok, nil
+}
@@ -0,0 +1,162 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 取自 RFC 8949 附录 A 以及 4.2.1 的确定性编码要求
+func TestCbor_DeterministicEncoding(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{0.0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1.5, "f93e00"},
+		{65504.0, "f97bff"},
+		{5.960464477539063e-8, "f90001"},
+		{100000.0, "fa47c35000"},
+		{3.4028234663852886e+38, "fa7f7fffff"},
+		{1.1, "fb3ff199999999999a"},
+		{math.Inf(-1), "f9fc00"},
+		{math.NaN(), "f97e00"},
+		{float32(0.5), "f93800"},
+		{false, "f4"},
+		{nil, "f6"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"IETF", "6449455446"},
+		{[]int{1, 2, 3}, "83010203"},
+		// 键按编码后的字节排序：短的在前，10 (0x0a) 在 100 (0x1864) 之前，-1 (0x20) 在最后
+		{map[int]string{100: "b", -1: "c", 10: "a"}, "a30a616118646162206163"},
+		{map[string]int{"aa": 2, "b": 1, "a": 0}, "a361610061620162616102"},
+		{struct {
+			Z int `cbor:"z"`
+			A int `cbor:"aa"`
+		}{1, 2}, "a2617a0162616102"},
+		{time.Unix(1363896240, 0), "c074323031332d30332d32315432303a30343a30305a"},
+	}
+	for _, tt := range tests {
+		b, err := MarshalCBOR(tt.v)
+		if err != nil || hex.EncodeToString(b) != tt.want {
+			t.Errorf("MarshalCBOR(%v) = %x, %v; want %s", tt.v, b, err, tt.want)
+		}
+	}
+}
+
+func TestCbor_RoundTrip(t *testing.T) {
+	type item struct {
+		Name  string             `json:"name"`
+		Price float64            `cbor:"price"`
+		Tags  []string           `cbor:"tags,omitempty"`
+		Attrs map[string]float32 `cbor:"attrs"`
+		Next  *item              `cbor:"next"`
+		When  time.Time          `cbor:"when"`
+		Any   interface{}        `cbor:"any"`
+	}
+	in := item{
+		Name:  "apple",
+		Price: 1.1,
+		Attrs: map[string]float32{"w": 0.25, "h": 100000},
+		Next:  &item{Name: "pear", Any: []interface{}{int64(-5), uint64(5), 2.5, "x", []byte{1}}},
+		When:  time.Unix(1700000000, 123).UTC(),
+		Any:   map[string]interface{}{"ok": true},
+	}
+	first, err := MarshalCBOR(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out item
+	if err := UnmarshalCBOR(first, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip mismatch:\nwant %+v\ngot  %+v", in, out)
+	}
+	// 重新编码得到完全相同的字节
+	for i := 0; i < 10; i++ {
+		b, _ := MarshalCBOR(out)
+		if string(b) != string(first) {
+			t.Fatalf("encoding is not deterministic:\n%x\n%x", first, b)
+		}
+	}
+
+	var n uint8
+	if err := UnmarshalCBOR([]byte{0x19, 0x01, 0x00}, &n); err == nil {
+		t.Fatal("expect overflow error")
+	}
+	if err := UnmarshalCBOR([]byte{0x9f, 0xff}, new([]int)); err == nil {
+		t.Fatal("expect error decoding indefinite-length array")
+	}
+	var tm time.Time
+	if err := UnmarshalCBOR([]byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}, &tm); err != nil || tm.Unix() != 1363896240 {
+		t.Fatalf("decode epoch time fail: %v, %v", tm, err)
+	}
+}
+
+func TestCbor_NestingDepth(t *testing.T) {
+	// 0x81 是只有一个元素的数组，0xc6 是标签 6，最内层是 null
+	for _, prefix := range []byte{0x81, 0xc6} {
+		data := append(bytes.Repeat([]byte{prefix}, 1<<20), 0xf6)
+		var v interface{}
+		if err := newCborDecoder(bytes.NewReader(data)).decodeInto(&v); err != errTooDeep {
+			t.Fatalf("%#x: expect errTooDeep, got %v", prefix, err)
+		}
+	}
+}
+
+func TestCbor_UnhashableKey(t *testing.T) {
+	// {[1]: 2}，数组不能作为 map 的键
+	var m map[interface{}]int
+	if err := UnmarshalCBOR([]byte{0xa1, 0x81, 0x01, 0x02}, &m); err == nil {
+		t.Fatal("expect error decoding unhashable map key")
+	}
+}
+
+type shadowLeft struct {
+	A, B, C int
+}
+
+type shadowRight struct {
+	A int
+	B int `json:"B"`
+	C int
+}
+
+type shadowed struct {
+	shadowLeft
+	shadowRight
+	A int
+}
+
+func TestCbor_ShadowedFields(t *testing.T) {
+	// 外层的 A 胜出，带标签的 B 胜出，无法区分的 C 被丢弃
+	v := shadowed{shadowLeft{1, 2, 3}, shadowRight{4, 5, 6}, 7}
+	want := map[string]int{"A": 7, "B": 5}
+	b, err := MarshalCBOR(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromCbor map[string]int
+	if err := UnmarshalCBOR(b, &fromCbor); err != nil || !reflect.DeepEqual(fromCbor, want) {
+		t.Fatalf("cbor fields: %v, %v", fromCbor, err)
+	}
+	if b, err = MarshalMsgpack(v); err != nil {
+		t.Fatal(err)
+	}
+	var fromMsgpack map[string]int
+	if err := UnmarshalMsgpack(b, &fromMsgpack); err != nil || !reflect.DeepEqual(fromMsgpack, want) {
+		t.Fatalf("msgpack fields: %v, %v", fromMsgpack, err)
+	}
+}
@@ -1,11 +1,24 @@
 package codec
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
 
 type Header struct {
 	ServiceMethod string
 	Sequence      uint64
-	Error         string
+	Error         string            // 错误信息
+	Code          uint32            // 错误码，0 表示成功
+	Details       []string          // 错误的附加信息
+	Metadata      map[string]string // 请求携带的元数据，例如调用方、链路追踪 ID
+	OneWay        bool              // 单向调用，服务端执行方法但不回复
+	Batch         uint32            // 批量调用的请求数，服务端读完整批请求后统一执行，并一次性回复
+	Parallel      bool              // 批量调用中的请求可以并发执行
+	Reverse       bool              // 服务端发起的反向调用的请求和响应，序列号单独编号
 }
 
 type Codec interface {
@@ -15,18 +28,98 @@ type Codec interface {
 	Write(*Header, interface{}) error
 }
 
+// BatchWriter 可以连续编码多条消息、只刷新一次缓冲区的编解码器，内置的编解码器都实现了该接口
+type BatchWriter interface {
+	WriteBatch(hs []*Header, bodies []interface{}) error
+}
+
+var (
+	_ BatchWriter = (*Job)(nil)
+	_ BatchWriter = (*Json)(nil)
+	_ BatchWriter = (*Proto)(nil)
+	_ BatchWriter = (*Msgpack)(nil)
+	_ BatchWriter = (*Cbor)(nil)
+)
+
+// WriteBatch 依次写入多条消息，编解码器实现了 BatchWriter 时整批只发送一次，否则逐条调用 Write
+func WriteBatch(c Codec, hs []*Header, bodies []interface{}) error {
+	if w, ok := c.(BatchWriter); ok {
+		return w.WriteBatch(hs, bodies)
+	}
+	for i, h := range hs {
+		if err := c.Write(h, bodies[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 
 type Type string
 
 const (
-	JobType  Type = "application/job"
-	JsonType Type = "application/json"
+	JobType     Type = "application/job"
+	JsonType    Type = "application/json"
+	ProtoType   Type = "application/protobuf"
+	MsgpackType Type = "application/msgpack"
+	CborType    Type = "application/cbor"
 )
 
-var NewCodecFuncMap map[Type]NewCodecFunc
+// ErrCodecExists 同一个编解码方式重复注册
+var ErrCodecExists = errors.New("rpc codec: codec already registered")
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[Type]NewCodecFunc)
+)
+
+// Register 注册一个编解码方式，可以并发调用，重复注册返回 ErrCodecExists。
+// 服务端在握手时会把所有已注册的编解码方式告诉客户端
+func Register(t Type, f NewCodecFunc) error {
+	if t == "" || f == nil {
+		return errors.New("rpc codec: invalid codec registration")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[t]; ok {
+		return fmt.Errorf("%w: %s", ErrCodecExists, t)
+	}
+	registry[t] = f
+	return nil
+}
+
+// 删除一个编解码方式，只在测试中用于清理注册
+func unregister(t Type) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, t)
+}
+
+// Lookup 查找编解码方式的构造函数
+func Lookup(t Type) (NewCodecFunc, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	f, ok := registry[t]
+	return f, ok
+}
+
+// Types 返回所有已注册的编解码方式，按名字排序
+func Types() []Type {
+	registryMu.RLock()
+	types := make([]Type, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	registryMu.RUnlock()
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
 
 func init() {
-	NewCodecFuncMap = make(map[Type]NewCodecFunc)
-	NewCodecFuncMap[JobType] = NewJobCodec
+	_ = Register(JobType, NewJobCodec)
+	_ = Register(JsonType, NewJsonCodec)
+	_ = Register(ProtoType, NewProtoCodec)
+	_ = Register(MsgpackType, NewMsgpackCodec)
+	_ = Register(CborType, NewCborCodec)
 }
@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	if err := Register(JsonType, NewJsonCodec); !errors.Is(err, ErrCodecExists) {
+		t.Fatalf("expect ErrCodecExists, got %v", err)
+	}
+	if err := Register("application/x-empty", nil); err == nil {
+		t.Fatal("expect error registering nil constructor")
+	}
+
+	// 并发注册和查找，同一个名字只有一次注册成功
+	t.Cleanup(func() {
+		for i := 0; i < 5; i++ {
+			unregister(Type(fmt.Sprintf("application/x-test-%d", i)))
+		}
+	})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if Register(Type(fmt.Sprintf("application/x-test-%d", i%5)), NewJsonCodec) == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = Lookup(JobType)
+			_ = Types()
+		}()
+	}
+	wg.Wait()
+	if succeeded != 5 {
+		t.Fatalf("expect 5 successful registrations, got %d", succeeded)
+	}
+	if f, ok := Lookup("application/x-test-3"); !ok || f == nil {
+		t.Fatal("registered codec not found")
+	}
+	if _, ok := Lookup("application/x-missing"); ok {
+		t.Fatal("unexpected codec found")
+	}
+	types := Types()
+	for i := 1; i < len(types); i++ {
+		if types[i-1] >= types[i] {
+			t.Fatalf("types not sorted: %v", types)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// byteReader 解码时使用的读取接口，bufio.Reader 和 bytes.Reader 都满足
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// valueKind MessagePack、CBOR 等自描述格式中值的种类
+type valueKind int
+
+const (
+	kindNil valueKind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindString
+	kindBinary
+	kindArray
+	kindMap
+	kindTime
+)
+
+func (k valueKind) String() string {
+	return [...]string{"nil", "bool", "int", "uint", "float", "string", "binary", "array", "map", "time"}[k]
+}
+
+// token 一个值的头部，数组和 map 只包含长度，元素需要继续读取
+type token struct {
+	kind valueKind
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	data []byte    // 字符串和二进制数据的内容，指向读取缓冲区，读取下一个 token 之前有效
+	n    int       // 数组和 map 的长度
+	t    time.Time // 时间扩展类型或标签
+}
+
+// valueDecoder 把 next 读出的 token 流解码到 Go 值，具体格式只需要实现 next
+type valueDecoder struct {
+	name  string // 格式名，用于错误信息
+	tag   string // 结构体字段使用的标签名
+	next  func() (token, error)
+	depth int // 当前数组和 map 的嵌套层数
+}
+
+// maxNestingDepth 数组、map 和 CBOR 标签的最大嵌套层数，解码是递归的，
+// 对端发来的深层嵌套数据会耗尽协程栈
+const maxNestingDepth = 1000
+
+var errTooDeep = errors.New("rpc codec: nesting too deep")
+
+// 进入一层数组或 map，返回前需要调用 leave
+func (d *valueDecoder) enter() error {
+	if d.depth >= maxNestingDepth {
+		return errTooDeep
+	}
+	d.depth++
+	return nil
+}
+
+func (d *valueDecoder) leave() {
+	d.depth--
+}
+
+// 读取 n 个字节到 *buf 中，复用 *buf 的空间
+func readBytes(r io.Reader, n uint64, buf *[]byte) ([]byte, error) {
+	if n > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	if uint64(cap(*buf)) < n {
+		*buf = make([]byte, n)
+	}
+	b := (*buf)[:n]
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// 值的中间读到 EOF 说明数据不完整
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decodeInto 解码到 v 指向的值
+func (d *valueDecoder) decodeInto(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("rpc codec: %s cannot decode into %T", d.name, v)
+	}
+	return d.decode(rv.Elem())
+}
+
+func (d *valueDecoder) decode(v reflect.Value) error {
+	tok, err := d.next()
+	if err != nil {
+		return err
+	}
+	return d.decodeToken(tok, v)
+}
+
+func (d *valueDecoder) decodeToken(tok token, v reflect.Value) error {
+	if tok.kind == kindNil {
+		v.SetZero()
+		return nil
+	}
+	if v.Type() == timeType {
+		if tok.kind != kindTime {
+			return d.mismatch(tok, v)
+		}
+		v.Set(reflect.ValueOf(tok.t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeToken(tok, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("rpc codec: %s cannot decode into %s", d.name, v.Type())
+		}
+		x, err := d.anyFromToken(tok)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+	switch tok.kind {
+	case kindBool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(tok.b)
+			return nil
+		}
+	case kindInt, kindUint, kindFloat:
+		if setNumber(v, tok) {
+			return nil
+		}
+	case kindString, kindBinary:
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(tok.data))
+			return nil
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), tok.data...))
+			return nil
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			reflect.Copy(v, reflect.ValueOf(tok.data))
+			return nil
+		}
+	case kindArray, kindMap:
+		if err := d.enter(); err != nil {
+			return err
+		}
+		defer d.leave()
+		if tok.kind == kindArray {
+			return d.decodeArray(tok.n, v)
+		}
+		return d.decodeMap(tok.n, v)
+	}
+	return d.mismatch(tok, v)
+}
+
+func (d *valueDecoder) mismatch(tok token, v reflect.Value) error {
+	return fmt.Errorf("rpc codec: %s cannot decode %s into %s", d.name, tok.kind, v.Type())
+}
+
+// setNumber 把整数或浮点数赋给数值类型的 v，溢出时返回 false
+func setNumber(v reflect.Value, tok token) bool {
+	i, u, f := tok.i, tok.u, tok.f
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch tok.kind {
+		case kindUint:
+			if u > math.MaxInt64 {
+				return false
+			}
+			i = int64(u)
+		case kindFloat:
+			return false
+		}
+		if v.OverflowInt(i) {
+			return false
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if tok.kind != kindUint || v.OverflowUint(u) {
+			return false
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch tok.kind {
+		case kindInt:
+			f = float64(i)
+		case kindUint:
+			f = float64(u)
+		}
+		v.SetFloat(f)
+	default:
+		return false
+	}
+	return true
+}
+
+func (d *valueDecoder) decodeArray(n int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		// 长度来自网络数据，不预先分配过大的切片
+		s := reflect.MakeSlice(v.Type(), 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			s = reflect.Append(s, reflect.Zero(v.Type().Elem()))
+			if err := d.decode(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		v.SetZero()
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("rpc codec: %s cannot decode array into %s", d.name, v.Type())
+}
+
+func (d *valueDecoder) decodeMap(n int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			// interface{} 键可能装着 slice 或 map，直接 SetMapIndex 会 panic
+			if key.Kind() == reflect.Interface && !key.IsNil() && !key.Elem().Type().Comparable() {
+				return fmt.Errorf("rpc codec: %s unsupported map key %s", d.name, key.Elem().Type())
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+	case reflect.Struct:
+		fields := cachedFields(v.Type(), d.tag)
+		for i := 0; i < n; i++ {
+			key, err := d.next()
+			if err != nil {
+				return err
+			}
+			if key.kind != kindString {
+				return fmt.Errorf("rpc codec: %s cannot decode %s key into %s", d.name, key.kind, v.Type())
+			}
+			f := findField(fields, key.data)
+			if f == nil {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(fieldByIndexAlloc(v, f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("rpc codec: %s cannot decode map into %s", d.name, v.Type())
+}
+
+// 解码成通用的 Go 值：map[string]interface{}（键不是字符串时为 map[interface{}]interface{}）、
+// []interface{}、int64、uint64、float64、string、[]byte、bool、time.Time 或 nil
+func (d *valueDecoder) decodeAny() (interface{}, error) {
+	tok, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	return d.anyFromToken(tok)
+}
+
+func (d *valueDecoder) anyFromToken(tok token) (interface{}, error) {
+	switch tok.kind {
+	case kindNil:
+		return nil, nil
+	case kindBool:
+		return tok.b, nil
+	case kindInt:
+		return tok.i, nil
+	case kindUint:
+		return tok.u, nil
+	case kindFloat:
+		return tok.f, nil
+	case kindString:
+		return string(tok.data), nil
+	case kindBinary:
+		return append([]byte(nil), tok.data...), nil
+	case kindTime:
+		return tok.t, nil
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	switch tok.kind {
+	case kindArray:
+		a := make([]interface{}, 0, min(tok.n, 1024))
+		for i := 0; i < tok.n; i++ {
+			x, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, x)
+		}
+		return a, nil
+	}
+	m := make(map[interface{}]interface{}, min(tok.n, 1024))
+	stringKeys := true
+	for i := 0; i < tok.n; i++ {
+		k, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(string); !ok {
+			stringKeys = false
+		}
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("rpc codec: %s unsupported map key %T", d.name, k)
+		}
+		if m[k], err = d.decodeAny(); err != nil {
+			return nil, err
+		}
+	}
+	if !stringKeys {
+		return m, nil
+	}
+	sm := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		sm[k.(string)] = v
+	}
+	return sm, nil
+}
+
+// 与 FieldByIndex 相同，但会为途经的 nil 指针分配内存
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,133 @@
+package codec
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldInfo 结构体中参与编码的一个字段
+type fieldInfo struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool // 名字来自标签
+}
+
+// 每种标签一个缓存，键是 reflect.Type，值是 []fieldInfo
+var fieldsCache = map[string]*sync.Map{
+	"msgpack": new(sync.Map),
+	"cbor":    new(sync.Map),
+}
+
+// cachedFields 返回结构体参与编码的字段，名字优先取 tag 指定的标签，其次是 json 标签，最后是字段名。
+// 标签为 "-" 的字段和未导出的字段被忽略，没有命名的嵌入结构体会展开到外层，同名字段按 dominantFields 的规则取舍
+func cachedFields(t reflect.Type, tag string) []fieldInfo {
+	cache := fieldsCache[tag]
+	if cache == nil {
+		return dominantFields(typeFields(t, tag, nil))
+	}
+	if f, ok := cache.Load(t); ok {
+		return f.([]fieldInfo)
+	}
+	f, _ := cache.LoadOrStore(t, dominantFields(typeFields(t, tag, nil)))
+	return f.([]fieldInfo)
+}
+
+func typeFields(t reflect.Type, tag string, index []int) []fieldInfo {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		value, ok := sf.Tag.Lookup(tag)
+		if !ok {
+			value = sf.Tag.Get("json")
+		}
+		if value == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(value, ",")
+		idx := append(append([]int(nil), index...), i)
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, typeFields(sf.Type, tag, idx)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		tagged := name != ""
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, fieldInfo{name: name, index: idx, omitEmpty: strings.Contains(","+opts+",", ",omitempty,"), tagged: tagged})
+	}
+	return fields
+}
+
+// dominantFields 与 encoding/json 的规则一致：同名字段中嵌入层次最浅的胜出，
+// 层次相同时带标签的胜出，仍然无法区分的字段全部丢弃
+func dominantFields(fields []fieldInfo) []fieldInfo {
+	byName := make(map[string][]int, len(fields))
+	for i, f := range fields {
+		byName[f.name] = append(byName[f.name], i)
+	}
+	out := fields[:0:0]
+	for i, f := range fields {
+		if dominantField(fields, byName[f.name]) == i {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// 返回同名字段中胜出的下标，没有胜出者时返回 -1
+func dominantField(fields []fieldInfo, same []int) int {
+	depth := len(fields[same[0]].index)
+	for _, i := range same {
+		depth = min(depth, len(fields[i].index))
+	}
+	winner, tagged, n := -1, 0, 0
+	for _, i := range same {
+		if len(fields[i].index) != depth {
+			continue
+		}
+		n++
+		if fields[i].tagged {
+			tagged++
+			winner = i
+		} else if n == 1 {
+			winner = i
+		}
+	}
+	if n == 1 || tagged == 1 {
+		return winner
+	}
+	return -1
+}
+
+// 按名字查找字段，先精确匹配，再忽略大小写匹配。name 直接使用解码缓冲区中的字节，不需要转换成字符串
+func findField(fields []fieldInfo, name []byte) *fieldInfo {
+	for i := range fields {
+		if fields[i].name == string(name) {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, string(name)) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// 与 encoding/json 的 omitempty 规则一致
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
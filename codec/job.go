@@ -30,12 +30,30 @@ func (c *Job) ReadBody(body interface{}) error {
 }
 
 func (c *Job) Write(h *Header, body interface{}) (err error) {
-	defer func() {
-		_ = c.buff.Flush()
-		if err != nil {
-			_ = c.Close()
+	defer c.flush(&err)
+	return c.write(h, body)
+}
+
+func (c *Job) WriteBatch(hs []*Header, bodies []interface{}) (err error) {
+	defer c.flush(&err)
+	for i, h := range hs {
+		if err = c.write(h, bodies[i]); err != nil {
+			return err
 		}
-	}()
+	}
+	return nil
+}
+
+// 刷新缓冲区，写入失败时关闭连接
+func (c *Job) flush(err *error) {
+	_ = c.buff.Flush()
+	if *err != nil {
+		_ = c.Close()
+	}
+}
+
+// 编码一条消息写入缓冲区，不刷新
+func (c *Job) write(h *Header, body interface{}) (err error) {
 	if err = c.encode.Encode(h); err != nil {
 		log.Println("rpc codec: gob error encoding header:", err)
 		return err
@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+)
+
+// Json 是 Codec 接口基于 JSON 的实现，header 和 body 依次编码为两个 JSON 值，
+// 便于命令行工具和其他语言直接读写
+type Json struct {
+	conn   io.ReadWriteCloser
+	buff   *bufio.Writer
+	decode *json.Decoder // json解码器
+	encode *json.Encoder // json编码器
+}
+
+var _ Codec = (*Json)(nil)
+
+func (c *Json) ReadHeader(h *Header) error {
+	return c.decode.Decode(h)
+}
+
+// ReadBody body 为 nil 时读取并丢弃一个 JSON 值
+func (c *Json) ReadBody(body interface{}) error {
+	if body == nil {
+		var discard json.RawMessage
+		return c.decode.Decode(&discard)
+	}
+	return c.decode.Decode(body)
+}
+
+func (c *Json) Write(h *Header, body interface{}) (err error) {
+	defer c.flush(&err)
+	return c.write(h, body)
+}
+
+func (c *Json) WriteBatch(hs []*Header, bodies []interface{}) (err error) {
+	defer c.flush(&err)
+	for i, h := range hs {
+		if err = c.write(h, bodies[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 刷新缓冲区，写入失败时关闭连接
+func (c *Json) flush(err *error) {
+	_ = c.buff.Flush()
+	if *err != nil {
+		_ = c.Close()
+	}
+}
+
+// 编码一条消息写入缓冲区，不刷新
+func (c *Json) write(h *Header, body interface{}) (err error) {
+	if err = c.encode.Encode(h); err != nil {
+		log.Println("rpc codec: json error encoding header:", err)
+		return err
+	}
+	if err = c.encode.Encode(body); err != nil {
+		log.Println("rpc codec: json error encoding body:", err)
+		return err
+	}
+	return err
+}
+
+func (c *Json) Close() error {
+	return c.conn.Close()
+}
+
+// NewJsonCodec 创建一个新的JsonCodec实例
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buffer := bufio.NewWriter(conn)
+	return &Json{
+		conn:   conn,
+		buff:   buffer,
+		decode: json.NewDecoder(conn),
+		encode: json.NewEncoder(buffer),
+	}
+}
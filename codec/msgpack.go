@@ -0,0 +1,301 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Msgpack 是 Codec 接口基于 MessagePack 的实现，header 和 body 依次编码为两个 MessagePack 值。
+// 结构体编码为以字段名为键的 map，字段名优先取 msgpack 标签，其次是 json 标签；
+// time.Time 使用 MessagePack 的 timestamp 扩展类型（-1）
+type Msgpack struct {
+	conn    io.ReadWriteCloser
+	reader  *bufio.Reader
+	buff    *bufio.Writer
+	scratch []byte        // 复用的编码缓冲区
+	dec     *valueDecoder // 复用的解码器
+}
+
+var _ Codec = (*Msgpack)(nil)
+
+func (c *Msgpack) ReadHeader(h *Header) error {
+	return c.dec.decodeInto(h)
+}
+
+// ReadBody body 为 nil 时读取并丢弃一个值
+func (c *Msgpack) ReadBody(body interface{}) error {
+	if body == nil {
+		_, err := c.dec.decodeAny()
+		return err
+	}
+	return c.dec.decodeInto(body)
+}
+
+func (c *Msgpack) Write(h *Header, body interface{}) (err error) {
+	defer c.flush(&err)
+	return c.write(h, body)
+}
+
+func (c *Msgpack) WriteBatch(hs []*Header, bodies []interface{}) (err error) {
+	defer c.flush(&err)
+	for i, h := range hs {
+		if err = c.write(h, bodies[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 刷新缓冲区，写入失败时关闭连接
+func (c *Msgpack) flush(err *error) {
+	_ = c.buff.Flush()
+	if *err != nil {
+		_ = c.Close()
+	}
+}
+
+// 编码一条消息写入缓冲区，不刷新
+func (c *Msgpack) write(h *Header, body interface{}) (err error) {
+	e := &msgpackEncoder{buf: c.scratch[:0]}
+	if err = e.encode(reflect.ValueOf(h)); err != nil {
+		log.Println("rpc codec: msgpack error encoding header:", err)
+		return err
+	}
+	if err = e.encode(reflect.ValueOf(body)); err != nil {
+		log.Println("rpc codec: msgpack error encoding body:", err)
+		return err
+	}
+	c.scratch = e.buf
+	_, err = c.buff.Write(e.buf)
+	return err
+}
+
+func (c *Msgpack) Close() error {
+	return c.conn.Close()
+}
+
+// NewMsgpackCodec 创建一个新的 MsgpackCodec 实例
+func NewMsgpackCodec(conn io.ReadWriteCloser) Codec {
+	reader := bufio.NewReader(conn)
+	return &Msgpack{
+		conn:   conn,
+		reader: reader,
+		buff:   bufio.NewWriter(conn),
+		dec:    newMsgpackDecoder(reader),
+	}
+}
+
+// MarshalMsgpack 把 v 编码为 MessagePack
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	err := e.encode(reflect.ValueOf(v))
+	return e.buf, err
+}
+
+// UnmarshalMsgpack 把 MessagePack 解码到 v 指向的值
+func UnmarshalMsgpack(data []byte, v interface{}) error {
+	return newMsgpackDecoder(bytes.NewReader(data)).decodeInto(v)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if v.Type() == timeType {
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xca), math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcb), math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(bytesOf(v))
+			return nil
+		}
+		e.encodeLen(v.Len(), 0x90, 16, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		e.encodeLen(v.Len(), 0x80, 16, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("rpc codec: msgpack cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	fields := cachedFields(v.Type(), "msgpack")
+	// 先数出需要编码的字段，避免为字段列表分配内存
+	n := 0
+	for _, f := range fields {
+		if !f.omitEmpty || !isEmptyValue(v.FieldByIndex(f.index)) {
+			n++
+		}
+	}
+	e.encodeLen(n, 0x80, 16, 0xde, 0xdf)
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		e.encodeString(f.name)
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 非负整数使用无符号格式，都选择能容纳该值的最短格式
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd2), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xce), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcf), n)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	if len(s) < 32 {
+		e.buf = append(e.buf, 0xa0|byte(len(s)))
+	} else {
+		e.encodeLen8(len(s), 0xd9, 0xda, 0xdb)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	e.encodeLen8(len(b), 0xc4, 0xc5, 0xc6)
+	e.buf = append(e.buf, b...)
+}
+
+// 数组和 map 的长度：小于 fixMax 时使用 fix 格式，否则使用 16 位或 32 位长度
+func (e *msgpackEncoder) encodeLen(n int, fix byte, fixMax int, c16, c32 byte) {
+	switch {
+	case n < fixMax:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, c16), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, c32), uint32(n))
+	}
+}
+
+// 字符串和二进制数据的长度：8 位、16 位或 32 位
+func (e *msgpackEncoder) encodeLen8(n int, c8, c16, c32 byte) {
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, c8, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, c16), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, c32), uint32(n))
+	}
+}
+
+// timestamp 扩展：秒数能用 32 位表示且没有纳秒时用 timestamp32，
+// 秒数在 34 位以内时用 timestamp64，否则用 timestamp96
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec>>32 == 0:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd6, 0xff), uint32(sec))
+	case sec>>34 == 0:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd7, 0xff), uint64(nsec)<<34|uint64(sec))
+	default:
+		e.buf = append(e.buf, 0xc7, 12, 0xff)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(nsec))
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(sec))
+	}
+}
+
+// 不可寻址的数组无法直接取 Bytes，需要先复制
+func bytesOf(v reflect.Value) []byte {
+	if v.Kind() == reflect.Slice || v.CanAddr() {
+		return v.Bytes()
+	}
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
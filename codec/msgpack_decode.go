@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+var errInvalidMsgpack = errors.New("rpc codec: invalid msgpack data")
+
+// msgpackReader 把 MessagePack 数据切分成 token
+type msgpackReader struct {
+	r   byteReader
+	buf []byte // 复用的读缓冲区
+}
+
+func newMsgpackDecoder(r byteReader) *valueDecoder {
+	return &valueDecoder{name: "msgpack", tag: "msgpack", next: (&msgpackReader{r: r}).next}
+}
+
+// 读取 n 个字节的大端序整数
+func (d *msgpackReader) readUint(n int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-n:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *msgpackReader) next() (tok token, err error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return tok, err
+	}
+	// 先读取长度或数值，再根据类型读取内容
+	var size uint64
+	ext := false
+	switch {
+	case c <= 0x7f:
+		return token{kind: kindUint, u: uint64(c)}, nil
+	case c >= 0xe0:
+		return token{kind: kindInt, i: int64(int8(c))}, nil
+	case c&0xf0 == 0x80:
+		return token{kind: kindMap, n: int(c & 0x0f)}, nil
+	case c&0xf0 == 0x90:
+		return token{kind: kindArray, n: int(c & 0x0f)}, nil
+	case c&0xe0 == 0xa0:
+		tok.kind, size = kindString, uint64(c&0x1f)
+	case c == 0xc0:
+		return token{kind: kindNil}, nil
+	case c == 0xc2 || c == 0xc3:
+		return token{kind: kindBool, b: c == 0xc3}, nil
+	case c >= 0xc4 && c <= 0xc6: // bin 8/16/32
+		tok.kind = kindBinary
+		size, err = d.readUint(1 << (c - 0xc4))
+	case c >= 0xc7 && c <= 0xc9: // ext 8/16/32
+		ext = true
+		size, err = d.readUint(1 << (c - 0xc7))
+	case c == 0xca:
+		u, err := d.readUint(4)
+		return token{kind: kindFloat, f: float64(math.Float32frombits(uint32(u)))}, err
+	case c == 0xcb:
+		u, err := d.readUint(8)
+		return token{kind: kindFloat, f: math.Float64frombits(u)}, err
+	case c >= 0xcc && c <= 0xcf: // uint 8/16/32/64
+		u, err := d.readUint(1 << (c - 0xcc))
+		return token{kind: kindUint, u: u}, err
+	case c >= 0xd0 && c <= 0xd3: // int 8/16/32/64
+		n := 1 << (c - 0xd0)
+		u, err := d.readUint(n)
+		// 符号扩展
+		shift := 64 - 8*n
+		return token{kind: kindInt, i: int64(u<<shift) >> shift}, err
+	case c >= 0xd4 && c <= 0xd8: // fixext 1/2/4/8/16
+		ext, size = true, 1<<(c-0xd4)
+	case c >= 0xd9 && c <= 0xdb: // str 8/16/32
+		tok.kind = kindString
+		size, err = d.readUint(1 << (c - 0xd9))
+	case c == 0xdc || c == 0xdd:
+		n, err := d.readUint(2 << (c - 0xdc))
+		return token{kind: kindArray, n: int(n)}, err
+	case c == 0xde || c == 0xdf:
+		n, err := d.readUint(2 << (c - 0xde))
+		return token{kind: kindMap, n: int(n)}, err
+	default:
+		return tok, errInvalidMsgpack
+	}
+	if err != nil {
+		return tok, err
+	}
+	if !ext {
+		tok.data, err = readBytes(d.r, size, &d.buf)
+		return tok, err
+	}
+	t, err := d.r.ReadByte()
+	if err != nil {
+		return tok, unexpectedEOF(err)
+	}
+	data, err := readBytes(d.r, size, &d.buf)
+	if err != nil {
+		return tok, err
+	}
+	// 只支持 timestamp 扩展
+	if int8(t) != -1 {
+		return tok, errInvalidMsgpack
+	}
+	tok.kind = kindTime
+	tok.t, err = decodeTimestamp(data)
+	return tok, err
+}
+
+// 解码 timestamp 扩展，时区统一为 UTC
+func decodeTimestamp(b []byte) (time.Time, error) {
+	switch len(b) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))).UTC(), nil
+	}
+	return time.Time{}, errInvalidMsgpack
+}
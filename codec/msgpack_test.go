@@ -0,0 +1,132 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Flag bool
+}
+
+type record struct {
+	inner
+	ID      uint32            `msgpack:"id"`
+	Name    string            `json:"name"`
+	Skip    string            `msgpack:"-"`
+	Empty   []int             `msgpack:"empty,omitempty"`
+	Scores  []float64         `msgpack:"scores"`
+	Labels  map[string]string `msgpack:"labels"`
+	Payload []byte            `msgpack:"payload"`
+	Next    *record           `msgpack:"next"`
+	Any     interface{}       `msgpack:"any"`
+	When    time.Time         `msgpack:"when"`
+}
+
+func TestMsgpack_Encoding(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{0, "00"},
+		{127, "7f"},
+		{128, "cc80"},
+		{-1, "ff"},
+		{-32, "e0"},
+		{-33, "d0df"},
+		{int64(math.MinInt64), "d38000000000000000"},
+		{uint64(math.MaxUint64), "cfffffffffffffffff"},
+		{1.5, "cb3ff8000000000000"},
+		{float32(1.5), "ca3fc00000"},
+		{"abc", "a3616263"},
+		{strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32)},
+		{[]byte{1, 2}, "c4020102"},
+		{[]int{1, 2}, "920102"},
+		{map[string]int{"a": 1}, "81a16101"},
+		{struct{ A int }{1}, "81a14101"},
+		{time.Unix(1, 0), "d6ff00000001"},
+	}
+	for _, tt := range tests {
+		b, err := MarshalMsgpack(tt.v)
+		if err != nil || hex.EncodeToString(b) != tt.want {
+			t.Errorf("MarshalMsgpack(%v) = %x, %v; want %s", tt.v, b, err, tt.want)
+		}
+	}
+}
+
+func TestMsgpack_RoundTrip(t *testing.T) {
+	in := record{
+		inner:   inner{Flag: true},
+		ID:      7,
+		Name:    "alice",
+		Skip:    "ignored",
+		Scores:  []float64{1, -2.5},
+		Labels:  map[string]string{"k": "v"},
+		Payload: bytes.Repeat([]byte{0xff}, 300),
+		Next:    &record{Name: "bob", Any: []interface{}{int64(-1), "x"}},
+		Any:     map[string]interface{}{"n": uint64(1)},
+		When:    time.Unix(1700000000, 123).UTC(),
+	}
+	b, err := MarshalMsgpack(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out record
+	if err := UnmarshalMsgpack(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := in
+	want.Skip = ""
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("round trip mismatch:\nwant %+v\ngot  %+v", want, out)
+	}
+
+	// 解码时字段名忽略大小写，不认识的字段被跳过
+	b, _ = MarshalMsgpack(map[string]interface{}{"NAME": "carol", "unknown": []int{1}})
+	out = record{}
+	if err := UnmarshalMsgpack(b, &out); err != nil || out.Name != "carol" {
+		t.Fatalf("decode by name fail: %+v, %v", out, err)
+	}
+
+	var n int8
+	b, _ = MarshalMsgpack(300)
+	if err := UnmarshalMsgpack(b, &n); err == nil {
+		t.Fatal("expect overflow error")
+	}
+	if err := UnmarshalMsgpack([]byte{0x92, 0x01}, new([]int)); err == nil {
+		t.Fatal("expect error decoding truncated data")
+	}
+}
+
+func TestMsgpack_NestingDepth(t *testing.T) {
+	// 每个 0x91 是只有一个元素的数组，最内层是 nil
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x91}, depth), 0xc0)
+	}
+	var v interface{}
+	if err := newMsgpackDecoder(bytes.NewReader(nested(maxNestingDepth))).decodeInto(&v); err != nil {
+		t.Fatalf("decode %d levels: %v", maxNestingDepth, err)
+	}
+	if err := newMsgpackDecoder(bytes.NewReader(nested(1 << 20))).decodeInto(&v); err != errTooDeep {
+		t.Fatalf("expect errTooDeep, got %v", err)
+	}
+	var s [][]interface{}
+	if err := newMsgpackDecoder(bytes.NewReader(nested(1 << 20))).decodeInto(&s); err != errTooDeep {
+		t.Fatalf("expect errTooDeep, got %v", err)
+	}
+}
+
+func TestMsgpack_UnhashableKey(t *testing.T) {
+	// {[1]: 2}，数组不能作为 map 的键
+	var m map[interface{}]int
+	if err := UnmarshalMsgpack([]byte{0x81, 0x91, 0x01, 0x02}, &m); err == nil {
+		t.Fatal("expect error decoding unhashable map key")
+	}
+}
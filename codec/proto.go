@@ -0,0 +1,439 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+)
+
+// ProtoMarshaler 可以编码成 protobuf 线路格式的类型，通常由 gorpc-gen -idl 生成
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// ProtoUnmarshaler 可以从 protobuf 线路格式解码的类型，通常由 gorpc-gen -idl 生成
+type ProtoUnmarshaler interface {
+	UnmarshalProto([]byte) error
+}
+
+// 单个帧或单个值的大小上限，避免恶意的长度前缀耗尽内存
+const maxMessageSize = 64 << 20
+
+var errMessageTooLarge = errors.New("rpc codec: message too large")
+
+// Proto 是 Codec 接口基于 protobuf 线路格式的实现。
+// header 和 body 分别编码为一个带 varint 长度前缀的 protobuf 消息；
+// body 需要实现 ProtoMarshaler/ProtoUnmarshaler，布尔、整数、浮点数、字符串和 []byte
+// 按 google.protobuf 包装类型的格式编码为字段 1
+type Proto struct {
+	conn    io.ReadWriteCloser
+	reader  *bufio.Reader
+	buff    *bufio.Writer
+	scratch []byte // 复用的编码缓冲区，Write 由调用方加锁，不会并发使用
+	frame   []byte // 复用的读缓冲区
+}
+
+var _ Codec = (*Proto)(nil)
+
+// 读取一个带长度前缀的帧，返回的数据在下一次读取前有效
+func (c *Proto) readFrame() ([]byte, error) {
+	n, err := binary.ReadUvarint(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	if uint64(cap(c.frame)) < n {
+		c.frame = make([]byte, n)
+	}
+	c.frame = c.frame[:n]
+	if _, err := io.ReadFull(c.reader, c.frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return c.frame, nil
+}
+
+func (c *Proto) ReadHeader(h *Header) error {
+	data, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	return unmarshalHeader(data, h)
+}
+
+// ReadBody body 为 nil 时读取并丢弃一帧
+func (c *Proto) ReadBody(body interface{}) error {
+	data, err := c.readFrame()
+	if err != nil || body == nil {
+		return err
+	}
+	return unmarshalBody(data, body)
+}
+
+func (c *Proto) Write(h *Header, body interface{}) (err error) {
+	defer c.flush(&err)
+	return c.write(h, body)
+}
+
+func (c *Proto) WriteBatch(hs []*Header, bodies []interface{}) (err error) {
+	defer c.flush(&err)
+	for i, h := range hs {
+		if err = c.write(h, bodies[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 刷新缓冲区，写入失败时关闭连接
+func (c *Proto) flush(err *error) {
+	_ = c.buff.Flush()
+	if *err != nil {
+		_ = c.Close()
+	}
+}
+
+// 编码一条消息写入缓冲区，不刷新
+func (c *Proto) write(h *Header, body interface{}) (err error) {
+	b := marshalHeader(c.scratch[:0], h)
+	hlen := len(b)
+	if b, err = marshalBody(b, body); err != nil {
+		log.Println("rpc codec: proto error encoding body:", err)
+		return err
+	}
+	c.scratch = b
+	var prefix [binary.MaxVarintLen64]byte
+	for _, frame := range [][]byte{b[:hlen], b[hlen:]} {
+		if _, err = c.buff.Write(binary.AppendUvarint(prefix[:0], uint64(len(frame)))); err != nil {
+			return err
+		}
+		if _, err = c.buff.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Proto) Close() error {
+	return c.conn.Close()
+}
+
+// NewProtoCodec 创建一个新的 ProtoCodec 实例
+func NewProtoCodec(conn io.ReadWriteCloser) Codec {
+	return &Proto{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		buff:   bufio.NewWriter(conn),
+	}
+}
+
+/*
+header 对应的 protobuf 定义：
+
+	message Header {
+	  string service_method = 1;
+	  uint64 sequence = 2;
+	  string error = 3;
+	  uint32 code = 4;
+	  repeated string details = 5;
+	  map<string, string> metadata = 6;
+	  bool one_way = 7;    // 单向调用，服务端不回复
+	  uint32 batch = 8;    // 批量调用的大小，非批量时不编码
+	  bool parallel = 9;   // 批量中的调用可以并发执行
+	  bool reverse = 10;   // 服务端发起的反向调用及其响应
+	}
+
+零值字段不编码，旧版本的对端会跳过不认识的字段
+*/
+func marshalHeader(b []byte, h *Header) []byte {
+	if h.ServiceMethod != "" {
+		b = AppendString(AppendTag(b, 1, WireBytes), h.ServiceMethod)
+	}
+	if h.Sequence != 0 {
+		b = AppendVarint(AppendTag(b, 2, WireVarint), h.Sequence)
+	}
+	if h.Error != "" {
+		b = AppendString(AppendTag(b, 3, WireBytes), h.Error)
+	}
+	if h.Code != 0 {
+		b = AppendVarint(AppendTag(b, 4, WireVarint), uint64(h.Code))
+	}
+	for _, d := range h.Details {
+		b = AppendString(AppendTag(b, 5, WireBytes), d)
+	}
+	for k, v := range h.Metadata {
+		entry := AppendString(AppendTag(nil, 1, WireBytes), k)
+		entry = AppendString(AppendTag(entry, 2, WireBytes), v)
+		b = AppendBytes(AppendTag(b, 6, WireBytes), entry)
+	}
+	if h.OneWay {
+		b = AppendVarint(AppendTag(b, 7, WireVarint), 1)
+	}
+	if h.Batch != 0 {
+		b = AppendVarint(AppendTag(b, 8, WireVarint), uint64(h.Batch))
+	}
+	if h.Parallel {
+		b = AppendVarint(AppendTag(b, 9, WireVarint), 1)
+	}
+	if h.Reverse {
+		b = AppendVarint(AppendTag(b, 10, WireVarint), 1)
+	}
+	return b
+}
+
+func unmarshalHeader(data []byte, h *Header) error {
+	*h = Header{}
+	r := NewProtoReader(data)
+	for !r.Done() {
+		num, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case num == 1 && wt == WireBytes:
+			v, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			h.ServiceMethod = string(v)
+		case num == 2 && wt == WireVarint:
+			if h.Sequence, err = r.Varint(); err != nil {
+				return err
+			}
+		case num == 3 && wt == WireBytes:
+			v, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			h.Error = string(v)
+		case num == 4 && wt == WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			h.Code = uint32(v)
+		case num == 5 && wt == WireBytes:
+			v, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			h.Details = append(h.Details, string(v))
+		case num == 6 && wt == WireBytes:
+			v, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			k, val, err := unmarshalStringEntry(v)
+			if err != nil {
+				return err
+			}
+			if h.Metadata == nil {
+				h.Metadata = make(map[string]string)
+			}
+			h.Metadata[k] = val
+		case num == 7 && wt == WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			h.OneWay = v != 0
+		case num == 8 && wt == WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			h.Batch = uint32(v)
+		case num == 9 && wt == WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			h.Parallel = v != 0
+		case num == 10 && wt == WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			h.Reverse = v != 0
+		default:
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 解码 map<string, string> 的一个条目
+func unmarshalStringEntry(data []byte) (key, value string, err error) {
+	r := NewProtoReader(data)
+	for !r.Done() {
+		num, wt, err := r.Next()
+		if err != nil {
+			return "", "", err
+		}
+		if (num == 1 || num == 2) && wt == WireBytes {
+			v, err := r.Bytes()
+			if err != nil {
+				return "", "", err
+			}
+			if num == 1 {
+				key = string(v)
+			} else {
+				value = string(v)
+			}
+			continue
+		}
+		if err := r.Skip(wt); err != nil {
+			return "", "", err
+		}
+	}
+	return key, value, nil
+}
+
+func marshalBody(b []byte, body interface{}) ([]byte, error) {
+	switch v := body.(type) {
+	case nil, struct{}:
+		return b, nil
+	case ProtoMarshaler:
+		data, err := v.MarshalProto()
+		return append(b, data...), err
+	}
+	return appendScalar(b, body)
+}
+
+func unmarshalBody(data []byte, body interface{}) error {
+	if v, ok := body.(ProtoUnmarshaler); ok {
+		return v.UnmarshalProto(data)
+	}
+	return unmarshalScalar(data, body)
+}
+
+// 标量按包装类型编码为字段 1，零值编码为空消息
+func appendScalar(b []byte, body interface{}) ([]byte, error) {
+	v := reflect.Indirect(reflect.ValueOf(body))
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			b = AppendVarint(AppendTag(b, 1, WireVarint), 1)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() != 0 {
+			b = AppendVarint(AppendTag(b, 1, WireVarint), uint64(v.Int()))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() != 0 {
+			b = AppendVarint(AppendTag(b, 1, WireVarint), v.Uint())
+		}
+	case reflect.Float32:
+		if v.Float() != 0 {
+			b = AppendFixed32(AppendTag(b, 1, WireFixed32), math.Float32bits(float32(v.Float())))
+		}
+	case reflect.Float64:
+		if v.Float() != 0 {
+			b = AppendFixed64(AppendTag(b, 1, WireFixed64), math.Float64bits(v.Float()))
+		}
+	case reflect.String:
+		if v.Len() > 0 {
+			b = AppendString(AppendTag(b, 1, WireBytes), v.String())
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return b, fmt.Errorf("rpc codec: proto cannot encode %T", body)
+		}
+		if v.Len() > 0 {
+			b = AppendBytes(AppendTag(b, 1, WireBytes), v.Bytes())
+		}
+	default:
+		return b, fmt.Errorf("rpc codec: proto cannot encode %T", body)
+	}
+	return b, nil
+}
+
+func unmarshalScalar(data []byte, body interface{}) error {
+	ptr := reflect.ValueOf(body)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("rpc codec: proto cannot decode into %T", body)
+	}
+	v := ptr.Elem()
+	var want WireType
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		want = WireVarint
+	case reflect.Float32:
+		want = WireFixed32
+	case reflect.Float64:
+		want = WireFixed64
+	case reflect.String:
+		want = WireBytes
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("rpc codec: proto cannot decode into %T", body)
+		}
+		want = WireBytes
+	default:
+		return fmt.Errorf("rpc codec: proto cannot decode into %T", body)
+	}
+	v.SetZero()
+	r := NewProtoReader(data)
+	for !r.Done() {
+		num, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if num != 1 || wt != want {
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+			continue
+		}
+		switch wt {
+		case WireVarint:
+			x, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			switch v.Kind() {
+			case reflect.Bool:
+				v.SetBool(x != 0)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				v.SetUint(x)
+			default:
+				v.SetInt(int64(x))
+			}
+		case WireFixed32:
+			x, err := r.Fixed32()
+			if err != nil {
+				return err
+			}
+			v.SetFloat(float64(math.Float32frombits(x)))
+		case WireFixed64:
+			x, err := r.Fixed64()
+			if err != nil {
+				return err
+			}
+			v.SetFloat(math.Float64frombits(x))
+		case WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			if v.Kind() == reflect.String {
+				v.SetString(string(x))
+			} else {
+				v.SetBytes(append([]byte(nil), x...))
+			}
+		}
+	}
+	return nil
+}
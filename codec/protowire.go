@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// WireType protobuf 的线路类型
+type WireType int
+
+const (
+	WireVarint  WireType = 0
+	WireFixed64 WireType = 1
+	WireBytes   WireType = 2
+	WireFixed32 WireType = 5
+)
+
+var (
+	errVarintOverflow = errors.New("rpc codec: proto varint overflow")
+	errInvalidTag     = errors.New("rpc codec: proto invalid field tag")
+)
+
+// AppendTag 追加字段编号和线路类型
+func AppendTag(b []byte, num int, wt WireType) []byte {
+	return AppendVarint(b, uint64(num)<<3|uint64(wt))
+}
+
+// AppendVarint 追加一个 varint
+func AppendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// AppendFixed32 按小端序追加 4 个字节
+func AppendFixed32(b []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// AppendFixed64 按小端序追加 8 个字节
+func AppendFixed64(b []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+// AppendBytes 追加长度前缀和数据
+func AppendBytes(b []byte, v []byte) []byte {
+	return append(AppendVarint(b, uint64(len(v))), v...)
+}
+
+// AppendString 追加长度前缀和字符串
+func AppendString(b []byte, v string) []byte {
+	return append(AppendVarint(b, uint64(len(v))), v...)
+}
+
+// ProtoReader 按 protobuf 线路格式依次读取字段，返回的 []byte 引用原始数据
+type ProtoReader struct {
+	buf []byte
+}
+
+// NewProtoReader 创建读取 data 的 ProtoReader
+func NewProtoReader(data []byte) *ProtoReader {
+	return &ProtoReader{buf: data}
+}
+
+// Done 是否已经读完
+func (r *ProtoReader) Done() bool {
+	return len(r.buf) == 0
+}
+
+// Next 读取下一个字段的编号和线路类型
+func (r *ProtoReader) Next() (int, WireType, error) {
+	v, err := r.Varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	num := v >> 3
+	if num == 0 || num > math.MaxInt32 {
+		return 0, 0, errInvalidTag
+	}
+	return int(num), WireType(v & 7), nil
+}
+
+func (r *ProtoReader) Varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf)
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if n < 0 {
+		return 0, errVarintOverflow
+	}
+	r.buf = r.buf[n:]
+	return v, nil
+}
+
+func (r *ProtoReader) Fixed32() (uint32, error) {
+	if len(r.buf) < 4 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.LittleEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v, nil
+}
+
+func (r *ProtoReader) Fixed64() (uint64, error) {
+	if len(r.buf) < 8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.LittleEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v, nil
+}
+
+// Bytes 读取一个长度前缀的字段
+func (r *ProtoReader) Bytes() ([]byte, error) {
+	n, err := r.Varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v, nil
+}
+
+// Skip 跳过一个不认识的字段，用于兼容新增的字段
+func (r *ProtoReader) Skip(wt WireType) error {
+	var err error
+	switch wt {
+	case WireVarint:
+		_, err = r.Varint()
+	case WireFixed64:
+		_, err = r.Fixed64()
+	case WireBytes:
+		_, err = r.Bytes()
+	case WireFixed32:
+		_, err = r.Fixed32()
+	default:
+		err = errInvalidTag
+	}
+	return err
+}
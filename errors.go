@@ -0,0 +1,152 @@
+package goRPC
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Code 错误码，随响应头一起传输，取值与 gRPC 的状态码保持一致，方便跨语言对接
+type Code uint32
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+var codeNames = map[Code]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// Error 结构化的 RPC 错误，服务端写入 Header 的 Code/Error/Details 字段，
+// 客户端读取响应头后重建，调用方可以通过 errors.As 取出错误码
+type Error struct {
+	Code    Code
+	Message string
+	Details []string
+}
+
+// NewError 创建一个带错误码的 RPC 错误
+func NewError(code Code, message string, details ...string) *Error {
+	return &Error{Code: code, Message: message, Details: details}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is 错误码相同，且目标的 Message 为空或与自身相同时认为匹配，
+// 因此 errors.Is(err, &Error{Code: NotFound}) 可以只按错误码判断。
+// 目标带有 reason 时按 reason 匹配，服务端包装过的哨兵错误传到客户端后 Message 不同，仍然可以判断
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || e.Code != t.Code {
+		return false
+	}
+	if t.Message == "" || t.Message == e.Message {
+		return true
+	}
+	reason := t.reason()
+	return reason != "" && reason == e.reason()
+}
+
+// reason 放在 Details 中随响应头传输，用于区分错误码相同的哨兵错误
+const reasonPrefix = "reason: "
+
+func (e *Error) reason() string {
+	for _, d := range e.Details {
+		if strings.HasPrefix(d, reasonPrefix) {
+			return d
+		}
+	}
+	return ""
+}
+
+// findServer 返回的哨兵错误，服务端和客户端都可以用 errors.Is 判断。
+// 传到客户端后 ErrInvalidServiceMethod 的错误码为 InvalidArgument，其余两个为 NotFound
+var (
+	ErrInvalidServiceMethod = NewError(InvalidArgument, "invalid service method", reasonPrefix+"INVALID_SERVICE_METHOD")
+	ErrServiceNotFound      = NewError(NotFound, "service not found", reasonPrefix+"SERVICE_NOT_FOUND")
+	ErrMethodNotFound       = NewError(NotFound, "method not found", reasonPrefix+"METHOD_NOT_FOUND")
+)
+
+// ErrorCode 取出错误链上的错误码，nil 返回 OK，非 *Error 返回 Unknown
+func ErrorCode(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return Unknown
+}
+
+// 把任意错误转换成 *Error，用于写入响应头。
+// 包装过的哨兵错误保留错误码，Message 取整条错误链的文本
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		if e == err {
+			return e
+		}
+		return &Error{Code: e.Code, Message: err.Error(), Details: e.Details}
+	}
+	return &Error{Code: Unknown, Message: err.Error()}
+}
+
+// 把 context 的错误转换成 Canceled/DeadlineExceeded
+func contextError(err error) *Error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewError(DeadlineExceeded, err.Error())
+	}
+	return NewError(Canceled, err.Error())
+}
+
+// 连接层面的错误统一转换成 Unavailable，方便重试策略判断
+func unavailable(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return NewError(Unavailable, err.Error())
+}
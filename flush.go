@@ -0,0 +1,178 @@
+package goRPC
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// FlushPolicy 客户端合并写配置。编解码器每次 Write 只写入内存缓冲区，
+// 由单独的发送协程统一写入连接，并发调用较多时多个请求只需要一次系统调用
+type FlushPolicy struct {
+	MaxDelay time.Duration // 收到数据后最多等待多久让其他写入方追加数据，缓冲区不再增长时提前写入，0 表示不等待
+	MaxBytes int           // 缓冲区上限，超过后不再等待 MaxDelay，写入方阻塞直到数据被发送，0 表示 64KB
+}
+
+const defaultFlushBytes = 64 << 10
+
+// Close 等待剩余数据写入连接的最长时间
+const flushCloseTimeout = time.Second
+
+// flushConn 包装连接，读操作直接转发，写操作写入缓冲区后唤醒发送协程。
+// 发送协程在锁外写连接，写连接期间到达的请求会积累下来，在下一次一起发送
+type flushConn struct {
+	conn     io.ReadWriteCloser
+	maxDelay time.Duration
+	maxBytes int
+
+	mu      sync.Mutex
+	cond    *sync.Cond // 缓冲区满时写入方在此等待
+	buf     []byte     // 等待发送的数据
+	spare   []byte     // 发送协程正在写入连接的数据，两个缓冲区轮换使用
+	err     error      // 写连接失败或已关闭后，之后的写入都返回该错误
+	wake    chan struct{}
+	closed  chan struct{}
+	stopped chan struct{} // 发送协程退出后关闭
+	closing sync.Once
+}
+
+func newFlushConn(conn io.ReadWriteCloser, p *FlushPolicy) *flushConn {
+	c := &flushConn{
+		conn:     conn,
+		maxDelay: p.MaxDelay,
+		maxBytes: p.MaxBytes,
+		wake:     make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = defaultFlushBytes
+	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.run()
+	return c
+}
+
+func (c *flushConn) Read(p []byte) (int, error) {
+	return c.conn.Read(p)
+}
+
+// Write 只写入缓冲区，缓冲区超过上限时等待发送协程写完
+func (c *flushConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	for c.err == nil && len(c.buf) >= c.maxBytes {
+		c.cond.Wait()
+	}
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return 0, err
+	}
+	c.buf = append(c.buf, p...)
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Close 等待发送协程退出，把缓冲区中剩余的数据写入连接后再关闭，已经返回成功的写入不会丢失。
+// 对端不读取数据时写连接会一直阻塞，超过 flushCloseTimeout 后直接关闭连接，剩余的数据被丢弃
+func (c *flushConn) Close() error {
+	var err error
+	first := false
+	c.closing.Do(func() {
+		first = true
+		close(c.closed)
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			<-c.stopped
+			c.mu.Lock()
+			out, err := c.buf, c.err
+			c.mu.Unlock()
+			c.fail(io.ErrClosedPipe)
+			if err == nil && len(out) > 0 {
+				_, _ = c.conn.Write(out)
+			}
+		}()
+		timer := time.NewTimer(flushCloseTimeout)
+		defer timer.Stop()
+		select {
+		case <-flushed:
+			err = c.conn.Close()
+		case <-timer.C:
+			// 关闭连接让阻塞的写操作返回
+			err = c.conn.Close()
+			<-flushed
+		}
+	})
+	if !first {
+		return c.conn.Close()
+	}
+	return err
+}
+
+// 记录第一个错误并唤醒所有等待的写入方
+func (c *flushConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.buf = nil
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// 发送协程：被唤醒后收集其他写入方的数据，然后交换缓冲区并在锁外写连接
+func (c *flushConn) run() {
+	defer close(c.stopped)
+	for {
+		select {
+		case <-c.wake:
+		case <-c.closed:
+			return
+		}
+		if c.maxDelay > 0 {
+			c.gather()
+		}
+		c.mu.Lock()
+		if len(c.buf) == 0 {
+			c.mu.Unlock()
+			continue
+		}
+		out := c.buf
+		c.buf = c.spare[:0]
+		c.mu.Unlock()
+		c.cond.Broadcast()
+		if _, err := c.conn.Write(out); err != nil {
+			c.fail(err)
+			_ = c.conn.Close()
+			return
+		}
+		c.spare = out
+	}
+}
+
+// 让出 CPU 给可以运行的写入方追加数据，缓冲区不再增长、已满或超过 maxDelay 时返回。
+// 请求应答模式下其余调用方都在等待响应，用定时器等满 maxDelay 只会增加延迟
+func (c *flushConn) gather() {
+	deadline := time.Now().Add(c.maxDelay)
+	n := c.buffered()
+	for n < c.maxBytes && time.Now().Before(deadline) {
+		runtime.Gosched()
+		m := c.buffered()
+		if m == n {
+			return
+		}
+		n = m
+	}
+}
+
+func (c *flushConn) buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.buf)
+}
@@ -0,0 +1,115 @@
+package goRPC
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ServingStatus 服务的健康状态
+type ServingStatus int
+
+const (
+	StatusUnknown    ServingStatus = iota // 未知
+	StatusServing                         // 正常提供服务
+	StatusNotServing                      // 暂停提供服务，例如正在关闭
+)
+
+func (s ServingStatus) String() string {
+	switch s {
+	case StatusServing:
+		return "SERVING"
+	case StatusNotServing:
+		return "NOT_SERVING"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// MarshalJSON 以字符串形式输出状态，便于命令行工具阅读
+func (s ServingStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON 同时接受字符串和数字形式的状态
+func (s *ServingStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*s = ServingStatus(n)
+		return nil
+	}
+	switch name {
+	case "SERVING":
+		*s = StatusServing
+	case "NOT_SERVING":
+		*s = StatusNotServing
+	default:
+		*s = StatusUnknown
+	}
+	return nil
+}
+
+// HealthCheckRequest Health.Check 的参数，Service 为空表示查询整个服务端的状态
+type HealthCheckRequest struct {
+	Service string
+}
+
+// HealthCheckResponse Health.Check 的返回值
+type HealthCheckResponse struct {
+	Status ServingStatus
+}
+
+// HealthServiceName 每个 Server 自动注册的健康检查服务名
+const HealthServiceName = "Health"
+
+// Health 内置的健康检查服务，NewServer 时自动注册。
+// 已注册但没有设置过状态的服务视为 SERVING，未注册的服务返回 NotFound
+type Health struct {
+	server   *Server
+	mu       sync.RWMutex
+	statuses map[string]ServingStatus // 键是服务名，"" 表示整个服务端
+}
+
+func newHealth(server *Server) *Health {
+	return &Health{
+		server:   server,
+		statuses: map[string]ServingStatus{"": StatusServing},
+	}
+}
+
+// Check 查询服务的健康状态
+func (h *Health) Check(req HealthCheckRequest, reply *HealthCheckResponse) error {
+	h.mu.RLock()
+	status, ok := h.statuses[req.Service]
+	h.mu.RUnlock()
+	if ok {
+		reply.Status = status
+		return nil
+	}
+	if _, registered := h.server.serviceMap.Load(req.Service); !registered {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, req.Service)
+	}
+	reply.Status = StatusServing
+	return nil
+}
+
+func (h *Health) setStatus(service string, status ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.statuses[service] = status
+}
+
+// SetServingStatus 设置服务的健康状态，service 为空表示整个服务端，
+// 例如在关闭服务端之前设置为 StatusNotServing，让客户端不再选择该服务端
+func (server *Server) SetServingStatus(service string, status ServingStatus) {
+	server.health.setStatus(service, status)
+}
+
+// SetServingStatus 设置 DefaultServer 中服务的健康状态
+func SetServingStatus(service string, status ServingStatus) {
+	DefaultServer.SetServingStatus(service, status)
+}
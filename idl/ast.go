@@ -0,0 +1,92 @@
+// Package idl 解析 goRPC 的接口定义语言，并生成 Go 类型、服务端接口和客户端代码。
+//
+//	package demo;
+//
+//	// 注释
+//	message Args {
+//	  int64 num1 = 1;
+//	  repeated string tags = 2;
+//	  map<string, Item> items = 3;
+//	}
+//
+//	service Foo {
+//	  rpc Sum(Args) returns (Reply);
+//	}
+//
+// 字段编号用于二进制编解码器，字段名用于 JSON 等按名字编码的编解码器，
+// 同一份定义文件可以在不同团队、不同编解码器之间共享
+package idl
+
+// File 一个 IDL 文件
+type File struct {
+	Package  string
+	Messages []*Message
+	Services []*Service
+}
+
+// Message 消息定义，对应 Go 的结构体
+type Message struct {
+	Name   string
+	Fields []*Field
+	Pos    Pos
+}
+
+// Field 消息的字段
+type Field struct {
+	Name   string
+	Number int
+	Type   *Type
+	Pos    Pos
+}
+
+// Type 字段或方法参数的类型
+type Type struct {
+	Name     string // 标量类型名或消息名，map 时为 "map"
+	Repeated bool   // repeated T，对应 Go 的切片
+	Key      *Type  // map 的键类型
+	Value    *Type  // map 的值类型
+}
+
+// Service 服务定义
+type Service struct {
+	Name    string
+	Methods []*Method
+	Pos     Pos
+}
+
+// Method 服务的方法
+type Method struct {
+	Name  string
+	Args  *Type
+	Reply *Type
+	Pos   Pos
+}
+
+// Pos 源码中的位置，用于报错
+type Pos struct {
+	Line, Col int
+}
+
+// 标量类型及其对应的 Go 类型
+var scalarTypes = map[string]string{
+	"bool":   "bool",
+	"int32":  "int32",
+	"int64":  "int64",
+	"uint32": "uint32",
+	"uint64": "uint64",
+	"float":  "float32",
+	"double": "float64",
+	"string": "string",
+	"bytes":  "[]byte",
+}
+
+// IsScalar 是否为标量类型
+func (t *Type) IsScalar() bool {
+	_, ok := scalarTypes[t.Name]
+	return ok && !t.Repeated
+}
+
+// IsMap 是否为 map 类型
+func (t *Type) IsMap() bool {
+	return t.Key != nil
+}
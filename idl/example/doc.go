@@ -0,0 +1,4 @@
+// Package example 是由 example.idl 生成的示例服务
+package example
+
+//go:generate go run goRPC/cmd/gorpc-gen -idl example.idl
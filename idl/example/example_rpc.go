@@ -0,0 +1,469 @@
+// Code generated by gorpc-gen from example.idl. DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"goRPC"
+	"goRPC/codec"
+	"math"
+)
+
+// Item 对应 IDL 中的 message Item
+type Item struct {
+	Name   string  `json:"name"`   // = 1
+	Price  float64 `json:"price"`  // = 2
+	Weight float32 `json:"weight"` // = 3
+}
+
+// MarshalProto 按 protobuf 线路格式编码
+func (m Item) MarshalProto() ([]byte, error) {
+	var b []byte
+	if m.Name != "" {
+		b = codec.AppendTag(b, 1, codec.WireBytes)
+		b = codec.AppendString(b, m.Name)
+	}
+	if m.Price != 0 {
+		b = codec.AppendTag(b, 2, codec.WireFixed64)
+		b = codec.AppendFixed64(b, math.Float64bits(m.Price))
+	}
+	if m.Weight != 0 {
+		b = codec.AppendTag(b, 3, codec.WireFixed32)
+		b = codec.AppendFixed32(b, math.Float32bits(m.Weight))
+	}
+	return b, nil
+}
+
+// UnmarshalProto 按 protobuf 线路格式解码，不认识的字段会被跳过
+func (m *Item) UnmarshalProto(data []byte) error {
+	*m = Item{}
+	r := codec.NewProtoReader(data)
+	for !r.Done() {
+		num, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case num == 1 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			v := string(x)
+			m.Name = v
+		case num == 2 && wt == codec.WireFixed64:
+			x, err := r.Fixed64()
+			if err != nil {
+				return err
+			}
+			v := math.Float64frombits(x)
+			m.Price = v
+		case num == 3 && wt == codec.WireFixed32:
+			x, err := r.Fixed32()
+			if err != nil {
+				return err
+			}
+			v := math.Float32frombits(x)
+			m.Weight = v
+		default:
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Order 对应 IDL 中的 message Order
+type Order struct {
+	Id         uint64           `json:"id"`         // = 1
+	Delta      int32            `json:"delta"`      // = 2
+	Paid       bool             `json:"paid"`       // = 3
+	Note       []byte           `json:"note"`       // = 4
+	Quantities []int64          `json:"quantities"` // = 5
+	Tags       []string         `json:"tags"`       // = 6
+	Items      []*Item          `json:"items"`      // = 7
+	ByName     map[string]*Item `json:"by_name"`    // = 8
+	Labels     map[int32]string `json:"labels"`     // = 9
+	Gift       *Item            `json:"gift"`       // = 10
+	Flags      []bool           `json:"flags"`      // = 11
+}
+
+// MarshalProto 按 protobuf 线路格式编码
+func (m Order) MarshalProto() ([]byte, error) {
+	var b []byte
+	if m.Id != 0 {
+		b = codec.AppendTag(b, 1, codec.WireVarint)
+		b = codec.AppendVarint(b, uint64(m.Id))
+	}
+	if m.Delta != 0 {
+		b = codec.AppendTag(b, 2, codec.WireVarint)
+		b = codec.AppendVarint(b, uint64(m.Delta))
+	}
+	if m.Paid {
+		b = codec.AppendTag(b, 3, codec.WireVarint)
+		b = codec.AppendVarint(b, 1)
+	}
+	if len(m.Note) > 0 {
+		b = codec.AppendTag(b, 4, codec.WireBytes)
+		b = codec.AppendBytes(b, m.Note)
+	}
+	if len(m.Quantities) > 0 {
+		var p []byte
+		for _, v := range m.Quantities {
+			p = codec.AppendVarint(p, uint64(v))
+		}
+		b = codec.AppendTag(b, 5, codec.WireBytes)
+		b = codec.AppendBytes(b, p)
+	}
+	for _, v := range m.Tags {
+		b = codec.AppendTag(b, 6, codec.WireBytes)
+		b = codec.AppendString(b, v)
+	}
+	for _, v := range m.Items {
+		if v == nil {
+			v = new(Item)
+		}
+		b = codec.AppendTag(b, 7, codec.WireBytes)
+		sub, err := v.MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = codec.AppendBytes(b, sub)
+	}
+	for k, v := range m.ByName {
+		var e []byte
+		if k != "" {
+			e = codec.AppendTag(e, 1, codec.WireBytes)
+			e = codec.AppendString(e, k)
+		}
+		if v != nil {
+			e = codec.AppendTag(e, 2, codec.WireBytes)
+			sub, err := v.MarshalProto()
+			if err != nil {
+				return nil, err
+			}
+			e = codec.AppendBytes(e, sub)
+		}
+		b = codec.AppendTag(b, 8, codec.WireBytes)
+		b = codec.AppendBytes(b, e)
+	}
+	for k, v := range m.Labels {
+		var e []byte
+		if k != 0 {
+			e = codec.AppendTag(e, 1, codec.WireVarint)
+			e = codec.AppendVarint(e, uint64(k))
+		}
+		if v != "" {
+			e = codec.AppendTag(e, 2, codec.WireBytes)
+			e = codec.AppendString(e, v)
+		}
+		b = codec.AppendTag(b, 9, codec.WireBytes)
+		b = codec.AppendBytes(b, e)
+	}
+	if m.Gift != nil {
+		b = codec.AppendTag(b, 10, codec.WireBytes)
+		sub, err := m.Gift.MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = codec.AppendBytes(b, sub)
+	}
+	if len(m.Flags) > 0 {
+		var p []byte
+		for _, v := range m.Flags {
+			var x uint64
+			if v {
+				x = 1
+			}
+			p = codec.AppendVarint(p, x)
+		}
+		b = codec.AppendTag(b, 11, codec.WireBytes)
+		b = codec.AppendBytes(b, p)
+	}
+	return b, nil
+}
+
+// UnmarshalProto 按 protobuf 线路格式解码，不认识的字段会被跳过
+func (m *Order) UnmarshalProto(data []byte) error {
+	*m = Order{}
+	r := codec.NewProtoReader(data)
+	for !r.Done() {
+		num, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case num == 1 && wt == codec.WireVarint:
+			x, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			v := uint64(x)
+			m.Id = v
+		case num == 2 && wt == codec.WireVarint:
+			x, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			v := int32(x)
+			m.Delta = v
+		case num == 3 && wt == codec.WireVarint:
+			x, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			v := x != 0
+			m.Paid = v
+		case num == 4 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			v := append([]byte(nil), x...)
+			m.Note = v
+		case num == 5 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			pr := codec.NewProtoReader(x)
+			for !pr.Done() {
+				x, err := pr.Varint()
+				if err != nil {
+					return err
+				}
+				v := int64(x)
+				m.Quantities = append(m.Quantities, v)
+			}
+		case num == 5 && wt == codec.WireVarint:
+			x, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			v := int64(x)
+			m.Quantities = append(m.Quantities, v)
+		case num == 6 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			v := string(x)
+			m.Tags = append(m.Tags, v)
+		case num == 7 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			v := new(Item)
+			if err := v.UnmarshalProto(x); err != nil {
+				return err
+			}
+			m.Items = append(m.Items, v)
+		case num == 8 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			var key string
+			var val *Item
+			er := codec.NewProtoReader(x)
+			for !er.Done() {
+				num, wt, err := er.Next()
+				if err != nil {
+					return err
+				}
+				switch {
+				case num == 1 && wt == codec.WireBytes:
+					x, err := er.Bytes()
+					if err != nil {
+						return err
+					}
+					v := string(x)
+					key = v
+				case num == 2 && wt == codec.WireBytes:
+					x, err := er.Bytes()
+					if err != nil {
+						return err
+					}
+					v := new(Item)
+					if err := v.UnmarshalProto(x); err != nil {
+						return err
+					}
+					val = v
+				default:
+					if err := er.Skip(wt); err != nil {
+						return err
+					}
+				}
+			}
+			if m.ByName == nil {
+				m.ByName = make(map[string]*Item)
+			}
+			m.ByName[key] = val
+		case num == 9 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			var key int32
+			var val string
+			er := codec.NewProtoReader(x)
+			for !er.Done() {
+				num, wt, err := er.Next()
+				if err != nil {
+					return err
+				}
+				switch {
+				case num == 1 && wt == codec.WireVarint:
+					x, err := er.Varint()
+					if err != nil {
+						return err
+					}
+					v := int32(x)
+					key = v
+				case num == 2 && wt == codec.WireBytes:
+					x, err := er.Bytes()
+					if err != nil {
+						return err
+					}
+					v := string(x)
+					val = v
+				default:
+					if err := er.Skip(wt); err != nil {
+						return err
+					}
+				}
+			}
+			if m.Labels == nil {
+				m.Labels = make(map[int32]string)
+			}
+			m.Labels[key] = val
+		case num == 10 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			v := new(Item)
+			if err := v.UnmarshalProto(x); err != nil {
+				return err
+			}
+			m.Gift = v
+		case num == 11 && wt == codec.WireBytes:
+			x, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			pr := codec.NewProtoReader(x)
+			for !pr.Done() {
+				x, err := pr.Varint()
+				if err != nil {
+					return err
+				}
+				v := x != 0
+				m.Flags = append(m.Flags, v)
+			}
+		case num == 11 && wt == codec.WireVarint:
+			x, err := r.Varint()
+			if err != nil {
+				return err
+			}
+			v := x != 0
+			m.Flags = append(m.Flags, v)
+		default:
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Empty 对应 IDL 中的 message Empty
+type Empty struct {
+}
+
+// MarshalProto 按 protobuf 线路格式编码
+func (m Empty) MarshalProto() ([]byte, error) {
+	var b []byte
+	return b, nil
+}
+
+// UnmarshalProto 按 protobuf 线路格式解码，不认识的字段会被跳过
+func (m *Empty) UnmarshalProto(data []byte) error {
+	*m = Empty{}
+	r := codec.NewProtoReader(data)
+	for !r.Done() {
+		_, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		default:
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ShopServer 是 Shop 服务需要实现的接口
+type ShopServer interface {
+	Submit(ctx context.Context, args Order, reply *Order) error
+	Total(ctx context.Context, args Order, reply *float64) error
+	Find(ctx context.Context, args string, reply *Item) error
+}
+
+// Shop 把 ShopServer 适配成可以注册到 goRPC.Server 的服务，服务名为 Shop
+type Shop struct {
+	impl ShopServer
+}
+
+func (s *Shop) Submit(ctx context.Context, args Order, reply *Order) error {
+	return s.impl.Submit(ctx, args, reply)
+}
+
+func (s *Shop) Total(ctx context.Context, args Order, reply *float64) error {
+	return s.impl.Total(ctx, args, reply)
+}
+
+func (s *Shop) Find(ctx context.Context, args string, reply *Item) error {
+	return s.impl.Find(ctx, args, reply)
+}
+
+// RegisterShopServer 把 impl 注册为 Shop 服务
+func RegisterShopServer(server *goRPC.Server, impl ShopServer) error {
+	return server.Register(&Shop{impl: impl})
+}
+
+// ShopClient 是 Shop 服务的类型安全客户端
+type ShopClient struct {
+	c goRPC.Caller
+}
+
+// NewShopClient 使用任意 goRPC.Caller 创建 ShopClient，例如 *goRPC.Client、*goRPC.ClientPool
+func NewShopClient(c goRPC.Caller) *ShopClient {
+	return &ShopClient{c: c}
+}
+
+// Submit 调用 Shop.Submit
+func (c *ShopClient) Submit(ctx context.Context, args Order) (Order, error) {
+	var reply Order
+	err := c.c.CallContext(ctx, "Shop.Submit", args, &reply)
+	return reply, err
+}
+
+// Total 调用 Shop.Total
+func (c *ShopClient) Total(ctx context.Context, args Order) (float64, error) {
+	var reply float64
+	err := c.c.CallContext(ctx, "Shop.Total", args, &reply)
+	return reply, err
+}
+
+// Find 调用 Shop.Find
+func (c *ShopClient) Find(ctx context.Context, args string) (Item, error) {
+	var reply Item
+	err := c.c.CallContext(ctx, "Shop.Find", args, &reply)
+	return reply, err
+}
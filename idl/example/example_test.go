@@ -0,0 +1,117 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"goRPC"
+	"goRPC/codec"
+	"net"
+	"reflect"
+	"testing"
+)
+
+type shop struct{}
+
+func (shop) Submit(ctx context.Context, args Order, reply *Order) error {
+	*reply = args
+	reply.Paid = true
+	return nil
+}
+
+func (shop) Total(ctx context.Context, args Order, reply *float64) error {
+	for i, item := range args.Items {
+		*reply += item.Price * float64(args.Quantities[i])
+	}
+	return nil
+}
+
+func (shop) Find(ctx context.Context, name string, reply *Item) error {
+	if name != "apple" {
+		return goRPC.NewError(goRPC.NotFound, "no such item", name, goRPC.MetadataFromContext(ctx)["user"])
+	}
+	*reply = Item{Name: name, Price: 1.5, Weight: 0.2}
+	return nil
+}
+
+func newOrder() Order {
+	apple := &Item{Name: "apple", Price: 1.5, Weight: 0.2}
+	return Order{
+		Id:         1 << 40,
+		Delta:      -7,
+		Note:       []byte{0, 1, 2},
+		Quantities: []int64{3, -1, 0},
+		Tags:       []string{"a", ""},
+		Items:      []*Item{apple, {Name: "pear", Price: 2}},
+		ByName:     map[string]*Item{"apple": apple, "": {Price: 1}},
+		Labels:     map[int32]string{-1: "neg", 2: "two"},
+		Gift:       &Item{},
+		Flags:      []bool{true, false},
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	order := newOrder()
+	data, err := order.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Order
+	if err := got.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(order, got) {
+		t.Fatalf("round trip mismatch:\nwant %+v\ngot  %+v", order, got)
+	}
+
+	// 字段编号相同但类型不同的字段会被当作未知字段跳过
+	var item Item
+	if err := item.UnmarshalProto(data); err != nil || item != (Item{}) {
+		t.Fatalf("expect unknown fields skipped, got %+v, %v", item, err)
+	}
+	if err := got.UnmarshalProto(data[:len(data)-1]); err == nil {
+		t.Fatal("expect error decoding truncated data")
+	}
+}
+
+func TestShop(t *testing.T) {
+	server := goRPC.NewServer()
+	if err := RegisterShopServer(server, shop{}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	for _, ct := range []codec.Type{codec.ProtoType, codec.JsonType, codec.MsgpackType, codec.CborType, codec.JobType} {
+		client, err := goRPC.Dial("tcp", l.Addr().String(), &goRPC.Option{CodecType: ct})
+		if err != nil {
+			t.Fatal(err)
+		}
+		shop := NewShopClient(client)
+		ctx := goRPC.WithMetadata(context.Background(), map[string]string{"user": "alice"})
+
+		order := newOrder()
+		reply, err := shop.Submit(ctx, order)
+		order.Paid = true
+		if err != nil || !reflect.DeepEqual(reply, order) {
+			t.Errorf("%s: Submit = %+v, %v", ct, reply, err)
+		}
+		total, err := shop.Total(ctx, order)
+		if err != nil || total != 2.5 {
+			t.Errorf("%s: Total = %v, %v", ct, total, err)
+		}
+		item, err := shop.Find(ctx, "apple")
+		if err != nil || item.Price != 1.5 {
+			t.Errorf("%s: Find = %+v, %v", ct, item, err)
+		}
+		_, err = shop.Find(ctx, "kiwi")
+		var e *goRPC.Error
+		if !errors.As(err, &e) || e.Code != goRPC.NotFound || !reflect.DeepEqual(e.Details, []string{"kiwi", "alice"}) {
+			t.Errorf("%s: expect NotFound with details, got %#v", ct, err)
+		}
+		_ = client.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package idl
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var goTemplate = template.Must(template.New("idl").Funcs(template.FuncMap{
+	"exported":  exported,
+	"fieldType": fieldType,
+	"argType":   argType,
+	"marshal":   marshalField,
+	"unmarshal": unmarshalField,
+}).Parse(`// Code generated by gorpc-gen from {{.Source}}. DO NOT EDIT.
+
+package {{.File.Package}}
+
+import (
+{{- if .File.Services}}
+	"context"
+	"goRPC"
+{{- end}}
+{{- if .File.Messages}}
+	"goRPC/codec"
+{{- end}}
+{{- if .Math}}
+	"math"
+{{- end}}
+)
+
+{{- range .File.Messages}}
+// {{.Name}} 对应 IDL 中的 message {{.Name}}
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{exported .Name}} {{fieldType .Type}} ` + "`" + `json:"{{.Name}}"` + "`" + ` // = {{.Number}}
+{{- end}}
+}
+
+// MarshalProto 按 protobuf 线路格式编码
+func (m {{.Name}}) MarshalProto() ([]byte, error) {
+	var b []byte
+{{- range .Fields}}
+	{{marshal .}}
+{{- end}}
+	return b, nil
+}
+
+// UnmarshalProto 按 protobuf 线路格式解码，不认识的字段会被跳过
+func (m *{{.Name}}) UnmarshalProto(data []byte) error {
+	*m = {{.Name}}{}
+	r := codec.NewProtoReader(data)
+	for !r.Done() {
+		{{if .Fields}}num{{else}}_{{end}}, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+{{- range .Fields}}
+		{{unmarshal .}}
+{{- end}}
+		default:
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+{{end}}
+{{- range .File.Services}}{{$svc := .Name}}
+// {{.Name}}Server 是 {{.Name}} 服务需要实现的接口
+type {{.Name}}Server interface {
+{{- range .Methods}}
+	{{exported .Name}}(ctx context.Context, args {{argType .Args}}, reply *{{argType .Reply}}) error
+{{- end}}
+}
+
+// {{.Name}} 把 {{.Name}}Server 适配成可以注册到 goRPC.Server 的服务，服务名为 {{.Name}}
+type {{.Name}} struct {
+	impl {{.Name}}Server
+}
+{{range .Methods}}
+func (s *{{$svc}}) {{exported .Name}}(ctx context.Context, args {{argType .Args}}, reply *{{argType .Reply}}) error {
+	return s.impl.{{exported .Name}}(ctx, args, reply)
+}
+{{end}}
+// Register{{.Name}}Server 把 impl 注册为 {{.Name}} 服务
+func Register{{.Name}}Server(server *goRPC.Server, impl {{.Name}}Server) error {
+	return server.Register(&{{.Name}}{impl: impl})
+}
+
+// {{.Name}}Client 是 {{.Name}} 服务的类型安全客户端
+type {{.Name}}Client struct {
+	c goRPC.Caller
+}
+
+// New{{.Name}}Client 使用任意 goRPC.Caller 创建 {{.Name}}Client，例如 *goRPC.Client、*goRPC.ClientPool
+func New{{.Name}}Client(c goRPC.Caller) *{{.Name}}Client {
+	return &{{.Name}}Client{c: c}
+}
+{{range .Methods}}
+// {{exported .Name}} 调用 {{$svc}}.{{exported .Name}}
+func (c *{{$svc}}Client) {{exported .Name}}(ctx context.Context, args {{argType .Args}}) ({{argType .Reply}}, error) {
+	var reply {{argType .Reply}}
+	err := c.c.CallContext(ctx, "{{$svc}}.{{exported .Name}}", args, &reply)
+	return reply, err
+}
+{{end}}
+{{- end}}`))
+
+// Generate 根据 IDL 生成 Go 代码：每个 message 生成一个结构体，
+// 每个 service 生成服务端接口、注册函数和客户端。
+// 结构体同时实现 codec.ProtoMarshaler 和 codec.ProtoUnmarshaler，可以使用 codec.ProtoType 编解码，source 是 IDL 文件名，只用于生成注释
+func Generate(f *File, source string) ([]byte, error) {
+	var buf bytes.Buffer
+	data := struct {
+		File   *File
+		Source string
+		Math   bool
+	}{f, source, usesMath(f)}
+	if err := goTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// 把 IDL 中的名字转换成导出的 Go 标识符，下划线分隔的单词首字母大写：user_id -> UserId
+func exported(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 字段的 Go 类型，消息类型使用指针，repeated 对应切片
+func fieldType(t *Type) string {
+	switch {
+	case t.IsMap():
+		return "map[" + scalarTypes[t.Key.Name] + "]" + elemType(t.Value)
+	case t.Repeated:
+		return "[]" + elemType(t)
+	}
+	return elemType(t)
+}
+
+func elemType(t *Type) string {
+	if goType, ok := scalarTypes[t.Name]; ok {
+		return goType
+	}
+	return "*" + t.Name
+}
+
+// 方法参数的 Go 类型，消息类型直接使用值
+func argType(t *Type) string {
+	if t.IsMap() || t.Repeated {
+		return fieldType(t)
+	}
+	if goType, ok := scalarTypes[t.Name]; ok {
+		return goType
+	}
+	return t.Name
+}
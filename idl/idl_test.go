@@ -0,0 +1,99 @@
+package idl
+
+import (
+	goparser "go/parser"
+	gotoken "go/token"
+	"strings"
+	"testing"
+)
+
+const demo = `package demo;
+
+/* 公共消息 */
+message Item {
+  string name = 1;
+  double price = 2;
+}
+
+message Args {
+  int64 num1 = 1;
+  int64 num2 = 2;
+  repeated string tags = 3;
+  map<string, Item> items = 4; // 按名字索引
+  Item first = 5;
+  bytes raw_data = 6;
+}
+
+service Foo {
+  rpc Sum(Args) returns (int64);
+  rpc Lookup(string) returns (Item);
+}
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(demo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Package != "demo" || len(f.Messages) != 2 || len(f.Services) != 1 {
+		t.Fatalf("unexpected file %+v", f)
+	}
+	args := f.Messages[1]
+	if len(args.Fields) != 6 || args.Fields[2].Type.Name != "string" || !args.Fields[2].Type.Repeated {
+		t.Fatalf("unexpected fields of Args: %+v", args.Fields)
+	}
+	items := args.Fields[3].Type
+	if !items.IsMap() || items.Key.Name != "string" || items.Value.Name != "Item" {
+		t.Fatalf("unexpected map type %+v", items)
+	}
+	m := f.Services[0].Methods[0]
+	if m.Name != "Sum" || m.Args.Name != "Args" || m.Reply.Name != "int64" || m.Pos.Line != 19 {
+		t.Fatalf("unexpected method %+v", m)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct{ src, err string }{
+		{"message A {}", "1:1: expected \"package\""},
+		{"package p;\nmessage A { int64 a = 1 }", "2:25: expected \";\""},
+		{"package p;\nmessage A { B b = 1; }", "2:13: undefined type B"},
+		{"package p;\nmessage A { int64 a = 1; int64 b = 1; }", "2:26: duplicate field number 1 in A"},
+		{"package p;\nmessage A { map<double, int64> m = 1; }", "2:13: invalid map key type double"},
+		{"package p;\nmessage A {}\nservice A {}", "3:1: duplicate definition A"},
+		{"package p;\nservice S { rpc M(C) returns (int64); }", "2:13: undefined type C"},
+		{"package p;\n/* open", "2:1: unterminated comment"},
+		{"package p;\nmessage A { int64 a = 0; }", "2:23: invalid field number 0"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("parse %q: expect error %q, got %v", tt.src, tt.err, err)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	f, err := Parse(demo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := Generate(f, "demo.idl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goparser.ParseFile(gotoken.NewFileSet(), "demo_rpc.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"Items   map[string]*Item `json:\"items\"`    // = 4",
+		"RawData []byte           `json:\"raw_data\"`",
+		"Sum(ctx context.Context, args Args, reply *int64) error",
+		"func RegisterFooServer(server *goRPC.Server, impl FooServer) error",
+		"func (c *FooClient) Lookup(ctx context.Context, args string) (Item, error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code missing %q\n%s", want, code)
+		}
+	}
+}
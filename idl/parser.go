@@ -0,0 +1,421 @@
+package idl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  Pos
+}
+
+// lexer 把源码切分成标识符、数字和符号，跳过空白和注释
+type lexer struct {
+	src  []rune
+	off  int
+	line int
+	col  int
+}
+
+func (l *lexer) peekRune(n int) rune {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() rune {
+	r := l.src[l.off]
+	l.off++
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+// 跳过空白、// 行注释和 /* */ 块注释
+func (l *lexer) skip() error {
+	for l.off < len(l.src) {
+		switch r := l.peekRune(0); {
+		case unicode.IsSpace(r):
+			l.advance()
+		case r == '/' && l.peekRune(1) == '/':
+			for l.off < len(l.src) && l.peekRune(0) != '\n' {
+				l.advance()
+			}
+		case r == '/' && l.peekRune(1) == '*':
+			pos := Pos{l.line, l.col}
+			l.advance()
+			l.advance()
+			for {
+				if l.off >= len(l.src) {
+					return &Error{Pos: pos, Msg: "unterminated comment"}
+				}
+				if l.peekRune(0) == '*' && l.peekRune(1) == '/' {
+					l.advance()
+					l.advance()
+					break
+				}
+				l.advance()
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	pos := Pos{l.line, l.col}
+	if l.off >= len(l.src) {
+		return token{kind: tokEOF, pos: pos}, nil
+	}
+	r := l.peekRune(0)
+	switch {
+	case r == '_' || unicode.IsLetter(r):
+		var b strings.Builder
+		for l.off < len(l.src) && (l.peekRune(0) == '_' || l.peekRune(0) == '.' || unicode.IsLetter(l.peekRune(0)) || unicode.IsDigit(l.peekRune(0))) {
+			b.WriteRune(l.advance())
+		}
+		return token{kind: tokIdent, text: b.String(), pos: pos}, nil
+	case unicode.IsDigit(r):
+		var b strings.Builder
+		for l.off < len(l.src) && unicode.IsDigit(l.peekRune(0)) {
+			b.WriteRune(l.advance())
+		}
+		return token{kind: tokNumber, text: b.String(), pos: pos}, nil
+	case strings.ContainsRune("{}()<>;=,", r):
+		l.advance()
+		return token{kind: tokPunct, text: string(r), pos: pos}, nil
+	}
+	return token{}, &Error{Pos: pos, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+// Error 带位置的解析错误
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+// parser 递归下降解析器，预读一个 token
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// Parse 解析 IDL 源码并检查类型引用、字段编号等是否合法
+func Parse(src string) (*File, error) {
+	p := &parser{lex: &lexer{src: []rune(src), line: 1, col: 1}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	f, err := p.parseFile()
+	if err != nil {
+		return nil, err
+	}
+	if err := check(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p *parser) next() (err error) {
+	p.tok, err = p.lex.next()
+	return err
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &Error{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// 期望当前 token 是指定的符号或关键字
+func (p *parser) expect(text string) error {
+	if (p.tok.kind != tokPunct && p.tok.kind != tokIdent) || p.tok.text != text {
+		return p.errorf("expected %q, found %q", text, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) ident() (string, Pos, error) {
+	if p.tok.kind != tokIdent {
+		return "", p.tok.pos, p.errorf("expected identifier, found %q", p.tok.text)
+	}
+	name, pos := p.tok.text, p.tok.pos
+	return name, pos, p.next()
+}
+
+func (p *parser) parseFile() (*File, error) {
+	f := new(File)
+	if err := p.expect("package"); err != nil {
+		return nil, err
+	}
+	name, _, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	f.Package = name
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	for p.tok.kind != tokEOF {
+		switch p.tok.text {
+		case "message":
+			m, err := p.parseMessage()
+			if err != nil {
+				return nil, err
+			}
+			f.Messages = append(f.Messages, m)
+		case "service":
+			s, err := p.parseService()
+			if err != nil {
+				return nil, err
+			}
+			f.Services = append(f.Services, s)
+		default:
+			return nil, p.errorf("expected message or service, found %q", p.tok.text)
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) parseMessage() (*Message, error) {
+	m := &Message{Pos: p.tok.pos}
+	if err := p.expect("message"); err != nil {
+		return nil, err
+	}
+	var err error
+	if m.Name, _, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.tok.text != "}" {
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		m.Fields = append(m.Fields, field)
+	}
+	return m, p.next()
+}
+
+// [repeated] type name = number ;
+func (p *parser) parseField() (*Field, error) {
+	field := &Field{Pos: p.tok.pos}
+	var err error
+	if field.Type, err = p.parseType(); err != nil {
+		return nil, err
+	}
+	if field.Name, _, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokNumber {
+		return nil, p.errorf("expected field number, found %q", p.tok.text)
+	}
+	if field.Number, err = strconv.Atoi(p.tok.text); err != nil || field.Number < 1 || field.Number > 1<<29-1 {
+		return nil, p.errorf("invalid field number %s", p.tok.text)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return field, p.expect(";")
+}
+
+// repeated T | map<K, V> | T
+func (p *parser) parseType() (*Type, error) {
+	if p.tok.kind == tokIdent && p.tok.text == "repeated" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if t.Repeated || t.IsMap() {
+			return nil, p.errorf("repeated must be followed by a scalar or message type")
+		}
+		t.Repeated = true
+		return t, nil
+	}
+	if p.tok.kind == tokIdent && p.tok.text == "map" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		key, _, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		value, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if value.Repeated || value.IsMap() {
+			return nil, p.errorf("map value must be a scalar or message type")
+		}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+		return &Type{Name: "map", Key: &Type{Name: key}, Value: value}, nil
+	}
+	name, _, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	return &Type{Name: name}, nil
+}
+
+func (p *parser) parseService() (*Service, error) {
+	s := &Service{Pos: p.tok.pos}
+	if err := p.expect("service"); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.Name, _, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.tok.text != "}" {
+		m, err := p.parseMethod()
+		if err != nil {
+			return nil, err
+		}
+		s.Methods = append(s.Methods, m)
+	}
+	return s, p.next()
+}
+
+// rpc Name(Args) returns (Reply);
+func (p *parser) parseMethod() (*Method, error) {
+	m := &Method{Pos: p.tok.pos}
+	if err := p.expect("rpc"); err != nil {
+		return nil, err
+	}
+	var err error
+	if m.Name, _, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if m.Args, err = p.parseType(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("returns"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if m.Reply, err = p.parseType(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return m, p.expect(";")
+}
+
+// 检查名字是否重复、类型是否已定义、字段编号是否重复
+func check(f *File) error {
+	messages := make(map[string]*Message)
+	names := make(map[string]bool)
+	for _, m := range f.Messages {
+		if names[m.Name] {
+			return &Error{Pos: m.Pos, Msg: "duplicate definition " + m.Name}
+		}
+		names[m.Name] = true
+		messages[m.Name] = m
+	}
+	for _, s := range f.Services {
+		if names[s.Name] {
+			return &Error{Pos: s.Pos, Msg: "duplicate definition " + s.Name}
+		}
+		names[s.Name] = true
+	}
+	resolve := func(t *Type, pos Pos) error {
+		for _, t := range []*Type{t, t.Key, t.Value} {
+			if t == nil || t.Name == "map" {
+				continue
+			}
+			if _, ok := scalarTypes[t.Name]; !ok && messages[t.Name] == nil {
+				return &Error{Pos: pos, Msg: "undefined type " + t.Name}
+			}
+		}
+		if t.IsMap() {
+			if _, ok := scalarTypes[t.Key.Name]; !ok || t.Key.Name == "bytes" || t.Key.Name == "float" || t.Key.Name == "double" {
+				return &Error{Pos: pos, Msg: "invalid map key type " + t.Key.Name}
+			}
+		}
+		return nil
+	}
+	for _, m := range f.Messages {
+		numbers := make(map[int]bool)
+		fields := make(map[string]bool)
+		for _, field := range m.Fields {
+			if numbers[field.Number] {
+				return &Error{Pos: field.Pos, Msg: fmt.Sprintf("duplicate field number %d in %s", field.Number, m.Name)}
+			}
+			if fields[field.Name] {
+				return &Error{Pos: field.Pos, Msg: fmt.Sprintf("duplicate field %s in %s", field.Name, m.Name)}
+			}
+			numbers[field.Number], fields[field.Name] = true, true
+			if err := resolve(field.Type, field.Pos); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range f.Services {
+		methods := make(map[string]bool)
+		for _, m := range s.Methods {
+			if methods[m.Name] {
+				return &Error{Pos: m.Pos, Msg: fmt.Sprintf("duplicate method %s in %s", m.Name, s.Name)}
+			}
+			methods[m.Name] = true
+			if err := resolve(m.Args, m.Pos); err != nil {
+				return err
+			}
+			if err := resolve(m.Reply, m.Pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
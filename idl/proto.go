@@ -0,0 +1,184 @@
+package idl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 生成 protobuf 线路格式的编解码方法，配合 codec.ProtoType 使用。
+// 标量使用 proto3 语义，零值不编码；数值类型的 repeated 字段使用 packed 编码，
+// 解码时两种格式都接受；map 编码为键为字段 1、值为字段 2 的条目
+
+// 标量的线路类型，消息类型返回 WireBytes
+func wireType(name string) string {
+	switch name {
+	case "bool", "int32", "int64", "uint32", "uint64":
+		return "codec.WireVarint"
+	case "float":
+		return "codec.WireFixed32"
+	case "double":
+		return "codec.WireFixed64"
+	}
+	return "codec.WireBytes"
+}
+
+// 数值类型的 repeated 字段可以 packed 编码
+func packable(name string) bool {
+	return wireType(name) != "codec.WireBytes"
+}
+
+// 生成把 expr 的值（不含字段编号）追加到 buf 的语句
+func appendValue(buf, name, expr string) string {
+	switch name {
+	case "bool":
+		return fmt.Sprintf("%s = codec.AppendVarint(%[1]s, 1)\n", buf)
+	case "int32", "int64", "uint32", "uint64":
+		return fmt.Sprintf("%s = codec.AppendVarint(%[1]s, uint64(%s))\n", buf, expr)
+	case "float":
+		return fmt.Sprintf("%s = codec.AppendFixed32(%[1]s, math.Float32bits(%s))\n", buf, expr)
+	case "double":
+		return fmt.Sprintf("%s = codec.AppendFixed64(%[1]s, math.Float64bits(%s))\n", buf, expr)
+	case "string":
+		return fmt.Sprintf("%s = codec.AppendString(%[1]s, %s)\n", buf, expr)
+	case "bytes":
+		return fmt.Sprintf("%s = codec.AppendBytes(%[1]s, %s)\n", buf, expr)
+	}
+	return fmt.Sprintf(`sub, err := %s.MarshalProto()
+if err != nil {
+	return nil, err
+}
+%s = codec.AppendBytes(%[2]s, sub)
+`, expr, buf)
+}
+
+// 生成追加一个带字段编号的值的语句，bool 只在为 true 时调用
+func appendField(buf string, num int, name, expr string) string {
+	return fmt.Sprintf("%s = codec.AppendTag(%[1]s, %d, %s)\n", buf, num, wireType(name)) + appendValue(buf, name, expr)
+}
+
+// 值为零时不编码的判断条件
+func nonZero(name, expr string) string {
+	switch name {
+	case "bool":
+		return expr
+	case "string":
+		return expr + ` != ""`
+	case "bytes":
+		return "len(" + expr + ") > 0"
+	}
+	if _, ok := scalarTypes[name]; ok {
+		return expr + " != 0"
+	}
+	return expr + " != nil"
+}
+
+func marshalField(f *Field) string {
+	t, expr := f.Type, "m."+exported(f.Name)
+	var b strings.Builder
+	switch {
+	case t.IsMap():
+		fmt.Fprintf(&b, "for k, v := range %s {\nvar e []byte\n", expr)
+		b.WriteString(appendEntryValue(1, t.Key.Name, "k"))
+		b.WriteString(appendEntryValue(2, t.Value.Name, "v"))
+		fmt.Fprintf(&b, "b = codec.AppendTag(b, %d, codec.WireBytes)\nb = codec.AppendBytes(b, e)\n}\n", f.Number)
+	case t.Repeated && packable(t.Name):
+		fmt.Fprintf(&b, "if len(%s) > 0 {\nvar p []byte\nfor _, v := range %[1]s {\n", expr)
+		b.WriteString(packedValue(t.Name))
+		fmt.Fprintf(&b, "}\nb = codec.AppendTag(b, %d, codec.WireBytes)\nb = codec.AppendBytes(b, p)\n}\n", f.Number)
+	case t.Repeated:
+		fmt.Fprintf(&b, "for _, v := range %s {\n", expr)
+		if _, ok := scalarTypes[t.Name]; !ok {
+			fmt.Fprintf(&b, "if v == nil {\nv = new(%s)\n}\n", t.Name)
+		}
+		b.WriteString(appendField("b", f.Number, t.Name, "v"))
+		b.WriteString("}\n")
+	default:
+		fmt.Fprintf(&b, "if %s {\n", nonZero(t.Name, expr))
+		b.WriteString(appendField("b", f.Number, t.Name, expr))
+		b.WriteString("}")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// packed 编码中 bool 需要写入实际的值
+func packedValue(name string) string {
+	if name == "bool" {
+		return "var x uint64\nif v {\nx = 1\n}\np = codec.AppendVarint(p, x)\n"
+	}
+	return appendValue("p", name, "v")
+}
+
+// map 条目的键和值，零值同样省略
+func appendEntryValue(num int, name, expr string) string {
+	return fmt.Sprintf("if %s {\n%s}\n", nonZero(name, expr), appendField("e", num, name, expr))
+}
+
+// 生成从 reader 读取一个值并赋给新变量 v 的语句
+func readValue(reader, name string) string {
+	switch name {
+	case "bool", "int32", "int64", "uint32", "uint64":
+		conv := scalarTypes[name] + "(x)"
+		if name == "bool" {
+			conv = "x != 0"
+		}
+		return fmt.Sprintf("x, err := %s.Varint()\nif err != nil {\nreturn err\n}\nv := %s\n", reader, conv)
+	case "float":
+		return fmt.Sprintf("x, err := %s.Fixed32()\nif err != nil {\nreturn err\n}\nv := math.Float32frombits(x)\n", reader)
+	case "double":
+		return fmt.Sprintf("x, err := %s.Fixed64()\nif err != nil {\nreturn err\n}\nv := math.Float64frombits(x)\n", reader)
+	case "string":
+		return fmt.Sprintf("x, err := %s.Bytes()\nif err != nil {\nreturn err\n}\nv := string(x)\n", reader)
+	case "bytes":
+		return fmt.Sprintf("x, err := %s.Bytes()\nif err != nil {\nreturn err\n}\nv := append([]byte(nil), x...)\n", reader)
+	}
+	return fmt.Sprintf(`x, err := %s.Bytes()
+if err != nil {
+	return err
+}
+v := new(%s)
+if err := v.UnmarshalProto(x); err != nil {
+	return err
+}
+`, reader, name)
+}
+
+// 生成 switch 中解码一个字段的 case 子句
+func unmarshalField(f *Field) string {
+	t, target := f.Type, "m."+exported(f.Name)
+	var b strings.Builder
+	switch {
+	case t.IsMap():
+		fmt.Fprintf(&b, "case num == %d && wt == codec.WireBytes:\n", f.Number)
+		b.WriteString("x, err := r.Bytes()\nif err != nil {\nreturn err\n}\n")
+		fmt.Fprintf(&b, "var key %s\nvar val %s\n", scalarTypes[t.Key.Name], elemType(t.Value))
+		b.WriteString("er := codec.NewProtoReader(x)\nfor !er.Done() {\nnum, wt, err := er.Next()\nif err != nil {\nreturn err\n}\nswitch {\n")
+		fmt.Fprintf(&b, "case num == 1 && wt == %s:\n%skey = v\n", wireType(t.Key.Name), readValue("er", t.Key.Name))
+		fmt.Fprintf(&b, "case num == 2 && wt == %s:\n%sval = v\n", wireType(t.Value.Name), readValue("er", t.Value.Name))
+		b.WriteString("default:\nif err := er.Skip(wt); err != nil {\nreturn err\n}\n}\n}\n")
+		fmt.Fprintf(&b, "if %s == nil {\n%[1]s = make(%s)\n}\n%[1]s[key] = val\n", target, fieldType(t))
+	case t.Repeated:
+		if packable(t.Name) {
+			fmt.Fprintf(&b, "case num == %d && wt == codec.WireBytes:\n", f.Number)
+			b.WriteString("x, err := r.Bytes()\nif err != nil {\nreturn err\n}\npr := codec.NewProtoReader(x)\nfor !pr.Done() {\n")
+			fmt.Fprintf(&b, "%s%s = append(%[2]s, v)\n}\n", readValue("pr", t.Name), target)
+		}
+		fmt.Fprintf(&b, "case num == %d && wt == %s:\n%s%s = append(%[4]s, v)\n", f.Number, wireType(t.Name), readValue("r", t.Name), target)
+	default:
+		fmt.Fprintf(&b, "case num == %d && wt == %s:\n%s%s = v\n", f.Number, wireType(t.Name), readValue("r", t.Name), target)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// 消息是否用到 math 包
+func usesMath(f *File) bool {
+	for _, m := range f.Messages {
+		for _, field := range m.Fields {
+			for _, t := range []*Type{field.Type, field.Type.Value} {
+				if t != nil && (t.Name == "float" || t.Name == "double") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
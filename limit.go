@@ -0,0 +1,87 @@
+package goRPC
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket 令牌桶限流器，令牌以 rate 个每秒的速度生成，最多积累 burst 个
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // 上一次补充令牌的时间
+}
+
+// NewTokenBucket 创建令牌桶，初始时桶是满的，burst 小于 1 时按 1 处理
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 按流逝的时间补充令牌，调用方需要持有锁
+func (tb *TokenBucket) refill(now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// 尝试取走一个令牌，失败时返回还需要等待的时间
+func (tb *TokenBucket) take() (bool, time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill(time.Now())
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// Allow 立即取走一个令牌，没有令牌时返回 false
+func (tb *TokenBucket) Allow() bool {
+	ok, _ := tb.take()
+	return ok
+}
+
+// Wait 阻塞直到取到一个令牌或 ctx 结束
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		ok, wait := tb.take()
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return contextError(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// ClientLimits 客户端限流配置
+type ClientLimits struct {
+	QPS         float64 // 每秒最多发出的请求数，0 表示不限制
+	Burst       int     // 令牌桶容量，允许的突发请求数
+	MaxInFlight int     // 最多同时等待响应的请求数，即 pending 的上限，0 表示不限制
+	FailFast    bool    // 超过限制时立即返回错误，否则阻塞等待
+}
+
+// 超过客户端限制时返回的错误，错误码为 ResourceExhausted
+var (
+	ErrRateLimited     = NewError(ResourceExhausted, "rpc client: rate limit exceeded")
+	ErrTooManyInFlight = NewError(ResourceExhausted, "rpc client: too many in-flight calls")
+)
@@ -0,0 +1,30 @@
+// Code generated by gorpc-gen. DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"goRPC"
+)
+
+// FooClient 是 Foo 服务的类型安全客户端
+type FooClient struct {
+	c goRPC.Caller
+}
+
+// NewFooClient 使用任意 goRPC.Caller 创建 FooClient，例如 *goRPC.Client、*goRPC.ClientPool
+func NewFooClient(c goRPC.Caller) *FooClient {
+	return &FooClient{c: c}
+}
+
+// Sum 调用 Foo.Sum
+func (c *FooClient) Sum(ctx context.Context, args Args) (int, error) {
+	var reply int
+	err := c.c.CallContext(ctx, "Foo.Sum", args, &reply)
+	return reply, err
+}
+
+// RegisterFoo 把 Foo 注册到 server
+func RegisterFoo(server *goRPC.Server, svc *Foo) error {
+	return server.Register(svc)
+}
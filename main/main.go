@@ -1,6 +1,9 @@
+//go:generate go run goRPC/cmd/gorpc-gen -type Foo
+
 package main
 
 import (
+	"context"
 	"goRPC"
 	"log"
 	"net"
@@ -11,7 +14,7 @@ import (
 // 启动RPC服务器并监听TCP连接, 随机分配的端口。 确保服务端端口监听成功, 客户端再发起请求
 func startServer(addr chan string) {
 	var foo Foo
-	if err := goRPC.Register(&foo); err != nil {
+	if err := RegisterFoo(goRPC.DefaultServer, &foo); err != nil {
 		log.Fatal(err)
 	}
 	log.Println("Starting server")
@@ -61,14 +64,12 @@ func main() {
 		go func(i int) {
 			defer wg.Done()
 			// RPC调用的参数
-			args := &Args{
+			args := Args{
 				i,
 				i * i,
 			}
-			// 接收RPC调用的结果
-			var reply string
-			// 发起RPC请求，方法名是"Foo.Sum"，参数是args，结果填充在reply变量中。
-			err := client.Call("Foo.Sum", args, &reply)
+			// 通过 gorpc-gen 生成的 FooClient 发起RPC请求，参数和返回值的类型在编译时检查
+			reply, err := NewFooClient(client).Sum(context.Background(), args)
 			log.Println(reply, err)
 			if err != nil {
 				log.Fatal("call error:", err)
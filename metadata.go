@@ -0,0 +1,17 @@
+package goRPC
+
+import "context"
+
+type metadataCtx struct{}
+
+// WithMetadata 把元数据附加到 ctx 上，CallContext 发送请求时写入 Header.Metadata。
+// 服务端方法收到的 ctx 中也带有请求的元数据，直接传给下游调用时元数据会继续传递
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	return context.WithValue(ctx, metadataCtx{}, md)
+}
+
+// MetadataFromContext 取出 ctx 中的元数据，没有时返回 nil
+func MetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataCtx{}).(map[string]string)
+	return md
+}
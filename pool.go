@@ -0,0 +1,110 @@
+package goRPC
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ClientPool 到同一个地址的连接池。
+// 单个 Client 的写操作都要经过 sending 锁，并发量大时会成为瓶颈，
+// ClientPool 维护多条连接，每次调用选择未完成请求最少的连接，断开的连接会自动重连
+type ClientPool struct {
+	members []*ReconnectClient
+	retry   *RetryPolicy // 重试时会换一条连接
+}
+
+var _ io.Closer = (*ClientPool)(nil)
+
+// DialPool 建立 size 条到 addr 的连接，policy 是每条连接的重连策略，为 nil 时使用 DefaultReconnectPolicy
+func DialPool(network, addr string, size int, policy *ReconnectPolicy, opts ...*Option) (*ClientPool, error) {
+	if size <= 0 {
+		return nil, errors.New("rpc client: pool size must be positive")
+	}
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	memberOpt := *opt
+	memberOpt.Retry = nil
+	pool := &ClientPool{retry: opt.Retry}
+	for i := 0; i < size; i++ {
+		rc, err := DialReconnect(network, addr, policy, &memberOpt)
+		if err != nil {
+			_ = pool.Close()
+			return nil, err
+		}
+		pool.members = append(pool.members, rc)
+	}
+	return pool, nil
+}
+
+// 选择未完成请求最少的可用连接，全部不可用时返回第一条连接，由它等待重连
+func (pool *ClientPool) pick() *ReconnectClient {
+	var best *ReconnectClient
+	bestPending := 0
+	for _, rc := range pool.members {
+		if !rc.IsAvailable() {
+			continue
+		}
+		if pending := rc.Pending(); best == nil || pending < bestPending {
+			best, bestPending = rc, pending
+		}
+	}
+	if best == nil {
+		return pool.members[0]
+	}
+	return best
+}
+
+// Size 连接池中的连接数
+func (pool *ClientPool) Size() int {
+	return len(pool.members)
+}
+
+// Pending 所有连接上尚未收到响应的调用总数
+func (pool *ClientPool) Pending() int {
+	n := 0
+	for _, rc := range pool.members {
+		n += rc.Pending()
+	}
+	return n
+}
+
+// IsAvailable 至少有一条连接可用
+func (pool *ClientPool) IsAvailable() bool {
+	for _, rc := range pool.members {
+		if rc.IsAvailable() {
+			return true
+		}
+	}
+	return false
+}
+
+// Close 关闭所有连接
+func (pool *ClientPool) Close() error {
+	var err error
+	for _, rc := range pool.members {
+		if e := rc.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (pool *ClientPool) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return pool.pick().Go(serviceMethod, args, reply, done)
+}
+
+func (pool *ClientPool) Call(serviceMethod string, args, reply interface{}) error {
+	return pool.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+func (pool *ClientPool) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if pool.retry == nil {
+		return pool.pick().CallContext(ctx, serviceMethod, args, reply)
+	}
+	return pool.retry.Do(ctx, serviceMethod, func(int) error {
+		return pool.pick().CallContext(ctx, serviceMethod, args, reply)
+	})
+}
@@ -0,0 +1,309 @@
+package goRPC
+
+import (
+	"context"
+	"goRPC/codec"
+	"log"
+	"sync"
+)
+
+// Backpressure 订阅者的发送队列满时的处理策略
+type Backpressure int
+
+const (
+	BackpressureDrop       Backpressure = iota // 丢弃发给该订阅者的新消息
+	BackpressureBlock                          // 发布方等待队列腾出位置
+	BackpressureDisconnect                     // 断开订阅者的连接
+)
+
+// PubSubServiceName 发布订阅服务的服务名
+const PubSubServiceName = "PubSub"
+
+// 服务端推送消息时反向调用的方法，客户端在接收循环中直接处理，保证消息的顺序
+const pubsubDeliver = PubSubServiceName + ".Deliver"
+
+const defaultQueueSize = 64
+
+// Message 发布到主题的一条消息，Data 的编码由发布方和订阅方约定
+type Message struct {
+	Topic string
+	Data  []byte
+}
+
+// MarshalProto 实现 codec.ProtoMarshaler，使用 protobuf 编解码器时也能推送消息
+func (m Message) MarshalProto() ([]byte, error) {
+	var b []byte
+	if m.Topic != "" {
+		b = codec.AppendString(codec.AppendTag(b, 1, codec.WireBytes), m.Topic)
+	}
+	if len(m.Data) > 0 {
+		b = codec.AppendBytes(codec.AppendTag(b, 2, codec.WireBytes), m.Data)
+	}
+	return b, nil
+}
+
+// UnmarshalProto 实现 codec.ProtoUnmarshaler
+func (m *Message) UnmarshalProto(data []byte) error {
+	*m = Message{}
+	r := codec.NewProtoReader(data)
+	for !r.Done() {
+		num, wt, err := r.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case num == 1 && wt == codec.WireBytes:
+			v, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			m.Topic = string(v)
+		case num == 2 && wt == codec.WireBytes:
+			v, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			m.Data = append([]byte(nil), v...)
+		default:
+			if err := r.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ErrNoCallback 请求不是通过 goRPC 连接发起的，无法推送消息
+var ErrNoCallback = NewError(FailedPrecondition, "pubsub: request has no connection to push messages")
+
+// PubSub 发布订阅服务，注册到 Server 后客户端通过 Client.Subscribe 在已有连接上订阅主题，
+// 服务端调用 Publish 把消息推送给所有订阅者。每个连接有一个发送队列和一个发送协程，
+// 队列满时按 Backpressure 策略处理
+type PubSub struct {
+	policy    Backpressure
+	queueSize int
+
+	mu     sync.Mutex
+	topics map[string]map[*subscriber]bool
+	conns  map[*Callback]*subscriber
+}
+
+// subscriber 一个订阅了主题的连接
+type subscriber struct {
+	cb     *Callback
+	queue  chan *Message
+	topics map[string]bool // 由 PubSub.mu 保护
+}
+
+// NewPubSub 创建发布订阅服务，queueSize 是每个连接的发送队列长度，<= 0 时为 64
+func NewPubSub(policy Backpressure, queueSize int) *PubSub {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	return &PubSub{
+		policy:    policy,
+		queueSize: queueSize,
+		topics:    make(map[string]map[*subscriber]bool),
+		conns:     make(map[*Callback]*subscriber),
+	}
+}
+
+// Subscribe 当前连接订阅主题，reply 为该连接订阅的主题数量
+func (ps *PubSub) Subscribe(ctx context.Context, topic string, reply *int) error {
+	cb, ok := CallbackFromContext(ctx)
+	if !ok {
+		return ErrNoCallback
+	}
+	if topic == "" {
+		return NewError(InvalidArgument, "pubsub: empty topic")
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	sub := ps.conns[cb]
+	if sub == nil {
+		sub = &subscriber{cb: cb, queue: make(chan *Message, ps.queueSize), topics: make(map[string]bool)}
+		ps.conns[cb] = sub
+		go ps.run(sub)
+	}
+	if ps.topics[topic] == nil {
+		ps.topics[topic] = make(map[*subscriber]bool)
+	}
+	ps.topics[topic][sub] = true
+	sub.topics[topic] = true
+	*reply = len(sub.topics)
+	return nil
+}
+
+// Unsubscribe 当前连接取消订阅主题，reply 为该连接仍然订阅的主题数量
+func (ps *PubSub) Unsubscribe(ctx context.Context, topic string, reply *int) error {
+	cb, ok := CallbackFromContext(ctx)
+	if !ok {
+		return ErrNoCallback
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	sub := ps.conns[cb]
+	if sub == nil {
+		return nil
+	}
+	ps.unsubscribe(sub, topic)
+	*reply = len(sub.topics)
+	return nil
+}
+
+// 调用方需要持有 ps.mu
+func (ps *PubSub) unsubscribe(sub *subscriber, topic string) {
+	delete(sub.topics, topic)
+	if subs := ps.topics[topic]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(ps.topics, topic)
+		}
+	}
+}
+
+// Publish 把消息放入订阅了 topic 的每个连接的发送队列，返回成功放入的数量。
+// BackpressureBlock 时会等待队列腾出位置，直到订阅者的连接断开
+func (ps *PubSub) Publish(topic string, data []byte) int {
+	ps.mu.Lock()
+	subs := make([]*subscriber, 0, len(ps.topics[topic]))
+	for sub := range ps.topics[topic] {
+		subs = append(subs, sub)
+	}
+	ps.mu.Unlock()
+
+	msg := &Message{Topic: topic, Data: data}
+	n := 0
+	for _, sub := range subs {
+		if ps.enqueue(sub, msg) {
+			n++
+		}
+	}
+	return n
+}
+
+func (ps *PubSub) enqueue(sub *subscriber, msg *Message) bool {
+	select {
+	case sub.queue <- msg:
+		return true
+	default:
+	}
+	switch ps.policy {
+	case BackpressureBlock:
+		select {
+		case sub.queue <- msg:
+			return true
+		case <-sub.cb.done:
+			return false
+		}
+	case BackpressureDisconnect:
+		log.Println("rpc pubsub: subscriber too slow, disconnect")
+		sub.cb.close()
+	}
+	return false
+}
+
+// Subscribers 返回订阅了 topic 的连接数量
+func (ps *PubSub) Subscribers(topic string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.topics[topic])
+}
+
+// 发送协程：按顺序把队列中的消息以单向反向调用推送给订阅者，连接断开后移除订阅者
+func (ps *PubSub) run(sub *subscriber) {
+	defer ps.remove(sub)
+	for {
+		select {
+		case msg := <-sub.queue:
+			if err := sub.cb.Notify(context.Background(), pubsubDeliver, msg); err != nil {
+				return
+			}
+		case <-sub.cb.done:
+			return
+		}
+	}
+}
+
+func (ps *PubSub) remove(sub *subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for topic := range sub.topics {
+		ps.unsubscribe(sub, topic)
+	}
+	delete(ps.conns, sub.cb)
+}
+
+// ErrSubscribed 同一个客户端重复订阅同一个主题
+var ErrSubscribed = NewError(AlreadyExists, "rpc client: topic already subscribed")
+
+// Subscribe 订阅服务端 PubSub 服务的主题，收到消息时调用 handler。
+// 同一个客户端的消息按服务端推送的顺序在同一个协程中处理，handler 处理过慢时
+// 服务端的发送队列会被填满，由服务端的 Backpressure 策略处理。
+// 积压的消息过多时接收循环会等待 handler，因此 handler 中不应同步调用同一个客户端
+func (client *Client) Subscribe(topic string, handler func(Message)) error {
+	client.subMu.Lock()
+	if _, ok := client.handlers[topic]; ok {
+		client.subMu.Unlock()
+		return ErrSubscribed
+	}
+	if client.handlers == nil {
+		client.handlers = make(map[string]func(Message))
+		client.messages = make(chan *Message, defaultQueueSize)
+		go client.dispatch()
+	}
+	client.handlers[topic] = handler
+	client.subMu.Unlock()
+
+	var n int
+	if err := client.Call(PubSubServiceName+".Subscribe", topic, &n); err != nil {
+		client.subMu.Lock()
+		delete(client.handlers, topic)
+		client.subMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe 取消订阅主题
+func (client *Client) Unsubscribe(topic string) error {
+	var n int
+	err := client.Call(PubSubServiceName+".Unsubscribe", topic, &n)
+	client.subMu.Lock()
+	delete(client.handlers, topic)
+	client.subMu.Unlock()
+	return err
+}
+
+// 在接收循环中读取推送的消息并交给 dispatch，队列满时接收循环等待，压力传递到服务端
+func (client *Client) deliver() error {
+	msg := new(Message)
+	if err := client.cc.ReadBody(msg); err != nil {
+		return err
+	}
+	client.subMu.Lock()
+	messages := client.messages
+	client.subMu.Unlock()
+	if messages == nil {
+		return nil
+	}
+	messages <- msg
+	return nil
+}
+
+// 按顺序调用订阅的 handler，接收循环退出后结束
+func (client *Client) dispatch() {
+	for {
+		select {
+		case msg := <-client.messages:
+			client.subMu.Lock()
+			handler := client.handlers[msg.Topic]
+			client.subMu.Unlock()
+			if handler != nil {
+				handler(*msg)
+			}
+		case <-client.broken:
+			return
+		}
+	}
+}
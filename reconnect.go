@@ -0,0 +1,222 @@
+package goRPC
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// ReconnectPolicy 断线重连时的退避参数
+type ReconnectPolicy struct {
+	InitialBackoff time.Duration // 第一次重连前的等待时间
+	MaxBackoff     time.Duration // 等待时间的上限
+	Multiplier     float64       // 每次重连等待时间的增长倍数
+	Jitter         float64       // 抖动比例，取值 0~1
+}
+
+// DefaultReconnectPolicy 默认的重连策略
+var DefaultReconnectPolicy = &ReconnectPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// ReconnectClient 自动重连的客户端。
+// 底层连接断开后只有正在进行中的调用会失败，随后按退避策略重新拨号并完成 Option 协议交换，
+// 重连成功后继续接受新的调用
+type ReconnectClient struct {
+	network string
+	addr    string
+	opt     *Option
+	retry   *RetryPolicy // 重试由 ReconnectClient 负责，可以跨越重连
+	policy  *ReconnectPolicy
+	done    chan struct{} // Close 时关闭，用于结束重连协程
+
+	mu      sync.Mutex    // 保护以下字段
+	client  *Client       // 当前使用的连接，重连期间为 nil
+	ready   chan struct{} // 重连成功或客户端关闭时关闭
+	closing bool
+}
+
+var _ io.Closer = (*ReconnectClient)(nil)
+
+// DialReconnect 建立一个自动重连的客户端，policy 为 nil 时使用 DefaultReconnectPolicy。
+// 第一次拨号失败直接返回错误
+func DialReconnect(network, addr string, policy *ReconnectPolicy, opts ...*Option) (*ReconnectClient, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		policy = DefaultReconnectPolicy
+	}
+	dialOpt := *opt
+	dialOpt.Retry = nil
+	client, err := Dial(network, addr, &dialOpt)
+	if err != nil {
+		return nil, err
+	}
+	ready := make(chan struct{})
+	close(ready)
+	rc := &ReconnectClient{
+		network: network,
+		addr:    addr,
+		opt:     &dialOpt,
+		retry:   opt.Retry,
+		policy:  policy,
+		done:    make(chan struct{}),
+		client:  client,
+		ready:   ready,
+	}
+	go rc.watch(client)
+	return rc, nil
+}
+
+// 等待当前连接断开，然后不断重连，直到成功或客户端被关闭
+func (rc *ReconnectClient) watch(client *Client) {
+	for {
+		select {
+		case <-client.broken:
+		case <-rc.done:
+			return
+		}
+		rc.mu.Lock()
+		if rc.closing {
+			rc.mu.Unlock()
+			return
+		}
+		rc.client = nil
+		rc.ready = make(chan struct{})
+		rc.mu.Unlock()
+
+		if client = rc.redial(); client == nil {
+			return
+		}
+	}
+}
+
+// 按退避策略重新拨号，客户端被关闭时返回 nil
+func (rc *ReconnectClient) redial() *Client {
+	for attempt := 1; ; attempt++ {
+		p := rc.policy
+		timer := time.NewTimer(backoff(p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter, attempt))
+		select {
+		case <-rc.done:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		opt := *rc.opt
+		client, err := Dial(rc.network, rc.addr, &opt)
+		if err != nil {
+			log.Println("rpc client: reconnect error:", err)
+			continue
+		}
+		rc.mu.Lock()
+		if rc.closing {
+			rc.mu.Unlock()
+			_ = client.Close()
+			return nil
+		}
+		rc.client = client
+		close(rc.ready)
+		rc.mu.Unlock()
+		return client
+	}
+}
+
+// 返回当前连接以及重连完成的通知通道，重连期间 client 为 nil
+func (rc *ReconnectClient) current() (*Client, <-chan struct{}, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closing {
+		return nil, nil, ErrShutdown
+	}
+	return rc.client, rc.ready, nil
+}
+
+// Close 关闭客户端并停止重连
+func (rc *ReconnectClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closing {
+		return ErrShutdown
+	}
+	rc.closing = true
+	close(rc.done)
+	if rc.client == nil {
+		close(rc.ready)
+		return nil
+	}
+	return rc.client.Close()
+}
+
+// IsAvailable 当前连接是否可以发送新的请求，重连期间返回 false
+func (rc *ReconnectClient) IsAvailable() bool {
+	client, _, err := rc.current()
+	return err == nil && client != nil && client.IsAvailable()
+}
+
+// Pending 当前连接上尚未收到响应的调用数量
+func (rc *ReconnectClient) Pending() int {
+	client, _, err := rc.current()
+	if err != nil || client == nil {
+		return 0
+	}
+	return client.Pending()
+}
+
+// Go 异步调用，重连期间直接以 ErrShutdown 结束调用
+func (rc *ReconnectClient) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	client, _, err := rc.current()
+	if err == nil && client != nil {
+		return client.Go(serviceMethod, args, reply, done)
+	}
+	if done == nil {
+		done = make(chan *Call, 10)
+	}
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Error:         ErrShutdown,
+		Done:          done,
+	}
+	call.done()
+	return call
+}
+
+func (rc *ReconnectClient) Call(serviceMethod string, args, reply interface{}) error {
+	return rc.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext 同步调用，重连期间等待重连成功或 ctx 结束
+func (rc *ReconnectClient) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if rc.retry == nil {
+		return rc.call(ctx, serviceMethod, args, reply)
+	}
+	return rc.retry.Do(ctx, serviceMethod, func(int) error {
+		return rc.call(ctx, serviceMethod, args, reply)
+	})
+}
+
+func (rc *ReconnectClient) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	for {
+		client, ready, err := rc.current()
+		if err != nil {
+			return err
+		}
+		if client != nil {
+			return client.CallContext(ctx, serviceMethod, args, reply)
+		}
+		select {
+		case <-ctx.Done():
+			return contextError(ctx.Err())
+		case <-ready:
+		}
+	}
+}
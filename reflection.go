@@ -0,0 +1,150 @@
+package goRPC
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReflectionServiceName 每个 Server 自动注册的反射服务名
+const ReflectionServiceName = "Reflection"
+
+// TypeDesc 类型的结构化描述，不依赖 Go 类型即可构造参数
+type TypeDesc struct {
+	Name   string      // 类型名，例如 "goRPC.Args"、"[]int"
+	Kind   string      // reflect.Kind，例如 "struct"、"ptr"、"slice"
+	Elem   *TypeDesc   `json:",omitempty"` // 指针、切片、数组、map 的元素类型
+	Key    *TypeDesc   `json:",omitempty"` // map 的键类型
+	Len    int         `json:",omitempty"` // 数组长度
+	Fields []FieldDesc `json:",omitempty"` // 结构体的导出字段
+	Ref    bool        `json:",omitempty"` // 递归类型再次出现时只给出名字，不再展开
+}
+
+// FieldDesc 结构体字段的描述
+type FieldDesc struct {
+	Name string
+	Tag  string `json:",omitempty"`
+	Type *TypeDesc
+}
+
+// ServiceDesc 服务及其方法名
+type ServiceDesc struct {
+	Name    string
+	Methods []string
+}
+
+// MethodDesc 方法的参数和返回值类型
+type MethodDesc struct {
+	ServiceMethod string
+	ArgType       *TypeDesc
+	ReplyType     *TypeDesc
+}
+
+// ListServicesRequest Reflection.ListServices 的参数，只返回名字以 Prefix 开头的服务
+type ListServicesRequest struct {
+	Prefix string
+}
+
+// ListServicesResponse Reflection.ListServices 的返回值，按服务名排序
+type ListServicesResponse struct {
+	Services []ServiceDesc
+}
+
+// DescribeMethodRequest Reflection.DescribeMethod 的参数
+type DescribeMethodRequest struct {
+	ServiceMethod string
+}
+
+// Reflection 内置的反射服务，NewServer 时自动注册，
+// 通用工具可以借助它在没有 Go 类型的情况下构造参数并调用服务
+type Reflection struct {
+	server *Server
+}
+
+// ListServices 列出所有已注册的服务和方法
+func (r *Reflection) ListServices(req ListServicesRequest, reply *ListServicesResponse) error {
+	r.server.serviceMap.Range(func(key, value interface{}) bool {
+		s := value.(*service)
+		if !strings.HasPrefix(s.name, req.Prefix) {
+			return true
+		}
+		desc := ServiceDesc{Name: s.name}
+		for name := range s.method {
+			desc.Methods = append(desc.Methods, name)
+		}
+		sort.Strings(desc.Methods)
+		reply.Services = append(reply.Services, desc)
+		return true
+	})
+	sort.Slice(reply.Services, func(i, j int) bool { return reply.Services[i].Name < reply.Services[j].Name })
+	return nil
+}
+
+// DescribeMethod 描述方法的参数和返回值类型
+func (r *Reflection) DescribeMethod(req DescribeMethodRequest, reply *MethodDesc) error {
+	_, mtype, err := r.server.findServer(req.ServiceMethod)
+	if err != nil {
+		return err
+	}
+	reply.ServiceMethod = req.ServiceMethod
+	reply.ArgType = describeType(mtype.ArgType, make(map[reflect.Type]bool))
+	reply.ReplyType = describeType(mtype.ReplyType, make(map[reflect.Type]bool))
+	return nil
+}
+
+// 递归描述类型，visiting 记录当前路径上正在展开的命名类型，避免递归类型无限展开
+func describeType(t reflect.Type, visiting map[reflect.Type]bool) *TypeDesc {
+	desc := &TypeDesc{Name: t.String(), Kind: t.Kind().String()}
+	if t.Name() != "" {
+		if visiting[t] {
+			desc.Ref = true
+			return desc
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		desc.Elem = describeType(t.Elem(), visiting)
+	case reflect.Array:
+		desc.Len = t.Len()
+		desc.Elem = describeType(t.Elem(), visiting)
+	case reflect.Map:
+		desc.Key = describeType(t.Key(), visiting)
+		desc.Elem = describeType(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			desc.Fields = append(desc.Fields, FieldDesc{
+				Name: f.Name,
+				Tag:  string(f.Tag),
+				Type: describeType(f.Type, visiting),
+			})
+		}
+	}
+	return desc
+}
+
+// String 返回类似 Go 语法的类型描述，便于命令行工具展示
+func (d *TypeDesc) String() string {
+	if d == nil {
+		return "<nil>"
+	}
+	if d.Kind != "struct" || d.Ref || len(d.Fields) == 0 {
+		return d.Name
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s struct {", d.Name)
+	for i, f := range d.Fields {
+		if i > 0 {
+			b.WriteString(";")
+		}
+		fmt.Fprintf(&b, " %s %s", f.Name, f.Type.Name)
+	}
+	b.WriteString(" }")
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package goRPC
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 客户端重试策略。
+// 只有标记为幂等的方法才会重试，且错误码必须在 RetryableCodes 中，
+// 每次重试前按指数退避等待，并加入随机抖动，避免大量客户端同时重试。
+// 幂等标记由调用方通过 MarkIdempotent 设置，服务端注册方法时不声明幂等性，
+// 调用方需要自己确认方法可以安全地重复执行
+type RetryPolicy struct {
+	MaxAttempts    int             // 最大尝试次数，包括第一次调用
+	InitialBackoff time.Duration   // 第一次重试前的等待时间
+	MaxBackoff     time.Duration   // 等待时间的上限
+	Multiplier     float64         // 每次重试等待时间的增长倍数
+	Jitter         float64         // 抖动比例，取值 0~1，实际等待时间在 [d*(1-Jitter), d*(1+Jitter)] 之间
+	RetryableCodes []Code          // 可以重试的错误码
+	Idempotent     map[string]bool // 幂等方法，键是 "Service.Method"
+}
+
+// DefaultRetryPolicy 默认的重试策略，通过 MarkIdempotent 得到标记了幂等方法的副本后使用，
+// 该变量本身不会被修改。默认只重试 Unavailable，ResourceExhausted 表示服务端已经过载，
+// 重试只会加重负载，需要时可以在副本中自行加入
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	RetryableCodes: []Code{Unavailable},
+}
+
+// MarkIdempotent 返回把方法标记为幂等的策略副本，只有幂等的方法才会被重试。
+// p 本身不会被修改，正在被客户端使用的策略也可以安全地调用
+func (p *RetryPolicy) MarkIdempotent(serviceMethods ...string) *RetryPolicy {
+	cp := *p
+	cp.Idempotent = make(map[string]bool, len(p.Idempotent)+len(serviceMethods))
+	for m, ok := range p.Idempotent {
+		cp.Idempotent[m] = ok
+	}
+	for _, m := range serviceMethods {
+		cp.Idempotent[m] = true
+	}
+	return &cp
+}
+
+// 判断一次失败的调用是否可以重试
+func (p *RetryPolicy) retryable(serviceMethod string, err error) bool {
+	if err == nil || !p.Idempotent[serviceMethod] {
+		return false
+	}
+	code := ErrorCode(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 第 attempt 次重试前需要等待的时间，attempt 从 1 开始
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	return backoff(p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter, attempt)
+}
+
+// 计算指数退避的等待时间：initial * multiplier^(attempt-1)，不超过 max，再加入 ±jitter 比例的抖动
+func backoff(initial, max time.Duration, multiplier, jitter float64, attempt int) time.Duration {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if max > 0 && d > float64(max) {
+		d = float64(max)
+	}
+	if jitter > 0 {
+		d += (rand.Float64()*2 - 1) * jitter * d
+	}
+	return time.Duration(d)
+}
+
+// Do 按策略执行 fn，fn 的参数是当前的尝试次数，从 0 开始。
+// 返回最后一次调用的错误；等待期间 ctx 结束则返回对应的 Canceled/DeadlineExceeded 错误
+func (p *RetryPolicy) Do(ctx context.Context, serviceMethod string, fn func(attempt int) error) error {
+	return p.do(ctx, serviceMethod, fn, nil)
+}
+
+// usable 不为 nil 且返回 false 时不再重试，例如同一个 Client 的连接已经关闭
+func (p *RetryPolicy) do(ctx context.Context, serviceMethod string, fn func(attempt int) error, usable func() bool) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(attempt); err == nil {
+			return nil
+		}
+		if attempt+1 >= p.MaxAttempts || !p.retryable(serviceMethod, err) || (usable != nil && !usable()) {
+			return err
+		}
+		timer := time.NewTimer(p.backoff(attempt + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return contextError(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
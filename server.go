@@ -1,8 +1,11 @@
 package goRPC
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"goRPC/codec"
 	"io"
 	"log"
@@ -10,7 +13,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 const MagicNumber = 0x3bef5c
@@ -24,8 +27,22 @@ Option 中的 CodeType 指定了 header 和 body 的编码方式
 type Option struct {
 	MagicNumber uint32
 	CodecType   codec.Type
+	Accept      []codec.Type  `json:",omitempty"` // 按优先级排列的候选编解码方式，非空时由服务端选择一个并回复 Handshake
+	Retry       *RetryPolicy  `json:"-"`          // 客户端重试策略，nil 表示不重试，不会发送给服务端
+	Limits      *ClientLimits `json:"-"`          // 客户端限流配置，nil 表示不限制，不会发送给服务端
+	Flush       *FlushPolicy  `json:"-"`          // 客户端合并写配置，nil 表示每个请求写完立即发送，不会发送给服务端
 }
 
+// Handshake 协商编解码方式时服务端在 Option 之后回复的 JSON
+type Handshake struct {
+	CodecType codec.Type   // 服务端选中的编解码方式
+	Codecs    []codec.Type // 服务端支持的全部编解码方式
+	Error     string       `json:",omitempty"`
+}
+
+// ErrCodecNotSupported 服务端不支持客户端提供的任何一种编解码方式
+var ErrCodecNotSupported = NewError(Unimplemented, "codec not supported")
+
 // DefaultOption 使用默认的Option
 var DefaultOption = &Option{
 	MagicNumber: MagicNumber,
@@ -34,10 +51,18 @@ var DefaultOption = &Option{
 
 type Server struct {
 	serviceMap sync.Map
+	admission  *admission                 // 准入控制，nil 表示不限制
+	health     *Health                    // 内置的健康检查服务
+	workers    atomic.Pointer[workerPool] // 处理请求的协程池，nil 表示每个请求一个协程
 }
 
+// NewServer 创建 Server 实例，并自动注册健康检查服务和反射服务
 func NewServer() *Server {
-	return &Server{}
+	server := &Server{}
+	server.health = newHealth(server)
+	_ = server.Register(server.health)
+	_ = server.Register(&Reflection{server: server})
+	return server
 }
 
 // DefaultServer 默认的 Server 实例
@@ -61,19 +86,19 @@ func Register(service interface{}) error {
 func (server *Server) findServer(serviceMethod string) (ser *service, methodtype *methodType, err error) {
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("invalid service method: " + serviceMethod)
+		err = fmt.Errorf("%w: %s", ErrInvalidServiceMethod, serviceMethod)
 		return
 	}
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	sv, ok := server.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("service not found: " + serviceName)
+		err = fmt.Errorf("%w: %s", ErrServiceNotFound, serviceName)
 		return
 	}
 	ser = sv.(*service)
 	methodtype = ser.method[methodName]
 	if methodtype == nil {
-		err = errors.New("method not found: " + methodName)
+		err = fmt.Errorf("%w: %s", ErrMethodNotFound, methodName)
 	}
 	return
 }
@@ -92,7 +117,6 @@ func (server *Server) Accept(lis net.Listener) {
 			log.Println(err)
 			return
 		}
-		time.Sleep(time.Second)
 		log.Println("serve conn")
 		go server.ServeConn(conn)
 	}
@@ -116,7 +140,8 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	var opt Option
 
 	// 读取 JSON 编码的数据，并将其解码到 opt 中
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
 		log.Println(err)
 		return
 	}
@@ -124,16 +149,55 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 		log.Println("invalid magic number")
 		return
 	}
-	f := codec.NewCodecFuncMap[opt.CodecType]
-	if f == nil {
+	if len(opt.Accept) > 0 {
+		opt.CodecType = negotiate(conn, opt.Accept)
+	}
+	f, ok := codec.Lookup(opt.CodecType)
+	if !ok {
 		log.Println("invalid codec type")
 		return
 	}
 	// 根据指定的编解码器类型创建一个新的编解码器实例
-	code := f(conn)
+	code := f(newHandshakeConn(dec, conn))
 	server.serveCodec(code)
 }
 
+// 从候选中选出第一个已注册的编解码方式，并把结果和支持的全部编解码方式回复给客户端，
+// 没有可用的编解码方式时返回空字符串
+func negotiate(conn io.Writer, accept []codec.Type) codec.Type {
+	hs := Handshake{Codecs: codec.Types()}
+	for _, t := range accept {
+		if _, ok := codec.Lookup(t); ok {
+			hs.CodecType = t
+			break
+		}
+	}
+	if hs.CodecType == "" {
+		hs.Error = ErrCodecNotSupported.Message
+	}
+	if err := json.NewEncoder(conn).Encode(&hs); err != nil {
+		log.Println("rpc server: write handshake error:", err)
+		return ""
+	}
+	return hs.CodecType
+}
+
+// handshakeConn 读取时先消费握手阶段缓冲的数据，写入和关闭直接交给原始连接
+type handshakeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// json.Decoder 可能已经多读了 Option 之后的报文，需要把缓冲区中剩余的数据拼回连接前面，
+// 同时跳过 json.Encoder 在 Option 末尾写入的换行符
+func newHandshakeConn(dec *json.Decoder, conn io.ReadWriteCloser) io.ReadWriteCloser {
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = r.ReadByte()
+	}
+	return &handshakeConn{Reader: r, WriteCloser: conn}
+}
+
 var invalidRequest = struct{}{}
 
 /*
@@ -146,64 +210,125 @@ func (server *Server) serveCodec(cc codec.Codec) {
 	sending := new(sync.Mutex)
 	// 确保在关闭编解码器之前所有的请求都已经被完全处理。
 	wg := new(sync.WaitGroup)
+	connLimiter := server.admission.newConnLimiter()
+	callback := newCallback(cc, sending)
 	for {
-		req, err := server.readRequest(cc)
-		if err != nil {
-			if req == nil {
+		req := requestPool.Get().(*request)
+		if err := server.readRequestHeader(cc, req.h); err != nil {
+			putRequest(req)
+			break
+		}
+		// 客户端对反向调用的响应
+		if req.h.Reverse {
+			err := callback.receive(req.h)
+			putRequest(req)
+			if err != nil {
 				break
 			}
-			req.h.Error = err.Error()
+			continue
+		}
+		err := server.readRequestBody(cc, req)
+		req.callback = callback
+		// 超过上限的批量不再缓存，其中的请求逐个拒绝
+		if req.h.Batch > maxBatchSize {
+			if err == nil {
+				err = fmt.Errorf("%w: batch size %d exceeds %d", ErrResourceExhausted, req.h.Batch, maxBatchSize)
+			}
+			req.h.Batch = 0
+		}
+		if req.h.Batch > 1 {
+			if !server.readBatch(cc, req, err, connLimiter, sending, wg) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			setHeaderError(req.h, err)
+			server.sendResponse(cc, req.h, invalidRequest, sending)
+			putRequest(req)
+			continue
+		}
+		// 超过限制的请求直接拒绝，不再创建协程
+		if req.release, err = server.admission.admit(connLimiter, req.h.ServiceMethod); err != nil {
+			setHeaderError(req.h, err)
 			server.sendResponse(cc, req.h, invalidRequest, sending)
+			putRequest(req)
 			continue
 		}
 		wg.Add(1)
 		// 使用了协程并发执行请求, 但是回复请求的报文必须是逐个发送的
 		log.Println("read req success")
-		go server.handleRequest(cc, req, sending, wg)
+		server.dispatch(serverTask{server: server, cc: cc, req: req, sending: sending, wg: wg})
 	}
+	// 先结束等待中的反向调用，正在等待它们的方法才能返回
+	callback.terminate()
 	wg.Wait()
 	_ = cc.Close()
 }
 
 type request struct {
 	h            *codec.Header
+	header       codec.Header // h 指向的请求头，随 request 一起复用
 	argv, replyv reflect.Value
 	mtype        *methodType
 	svc          *service
+	release      func()    // 方法执行完后释放准入许可，反向调用没有准入控制，为 nil
+	callback     *Callback // 发起请求的连接，方法可以通过它反向调用客户端
+}
+
+// 回复发送之后 request 不再被引用，放回 requestPool 复用
+var requestPool = sync.Pool{
+	New: func() interface{} {
+		req := new(request)
+		req.h = &req.header
+		return req
+	},
+}
+
+func putRequest(req *request) {
+	*req = request{}
+	req.h = &req.header
+	requestPool.Put(req)
 }
 
 // 读取请求头信息, 用 ReadHeader 方法来填充 h
-func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
+func (server *Server) readRequestHeader(cc codec.Codec, h *codec.Header) error {
 	log.Println("start read request header")
 	defer log.Println("end read request header")
-	var h codec.Header
-	if err := cc.ReadHeader(&h); err != nil {
+	if err := cc.ReadHeader(h); err != nil {
 		log.Println(err)
 		if err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
 			log.Println(err)
 		}
-		return nil, err
+		return err
 	}
-	return &h, nil
+	return nil
 }
 
 // 读取完整的请求, 包括请求头和请求体
 func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	log.Println("start read request")
 	defer log.Println("end read request")
-	h, err := server.readRequestHeader(cc)
-	if err != nil {
+	req := requestPool.Get().(*request)
+	if err := server.readRequestHeader(cc, req.h); err != nil {
+		putRequest(req)
 		return nil, err
 	}
-	req := &request{h: h}
-	req.svc, req.mtype, err = server.findServer(h.ServiceMethod)
+	return req, server.readRequestBody(cc, req)
+}
+
+// 根据已经读到的请求头找到方法，再读取请求体
+func (server *Server) readRequestBody(cc codec.Codec, req *request) (err error) {
+	req.svc, req.mtype, err = server.findServer(req.h.ServiceMethod)
 	if err != nil {
-		return req, err
+		// 丢弃请求体，保证下一次读取从新的请求头开始
+		_ = cc.ReadBody(nil)
+		return err
 	}
 
 	// 创建两个入参实例
 	req.argv = req.mtype.newArgv()
-	req.argv = req.mtype.newReplyv()
+	req.replyv = req.mtype.newReplyv()
 
 	argvi := req.argv.Interface()
 	if req.argv.Type().Kind() != reflect.Ptr {
@@ -213,14 +338,21 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	// 使用 cc.ReadBody() 将请求报文反序列化为第一个入参 argv
 	if err = cc.ReadBody(argvi); err != nil {
 		log.Println(err)
-		return req, err
+		return err
 	}
-	return req, nil
+	return nil
 }
 
 func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
 	log.Println("start send response")
 	defer log.Println("end send response")
+	// 单向调用不回复，失败时只记录日志
+	if h.OneWay {
+		if h.Error != "" {
+			log.Println("rpc server: one-way call", h.ServiceMethod, "error:", h.Error)
+		}
+		return
+	}
 	sending.Lock()
 	defer sending.Unlock()
 
@@ -229,20 +361,41 @@ func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interfa
 	}
 }
 
+// 把错误转换成 *Error 后写入响应头的 Error/Code/Details 字段
+func setHeaderError(h *codec.Header, err error) {
+	e := toError(err)
+	h.Error = e.Message
+	h.Code = uint32(e.Code)
+	h.Details = e.Details
+}
+
 func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup) {
 	log.Println("start handle request")
 	defer log.Println("end handle request")
 	defer wg.Done()
-	log.Println(req.h, req.argv.Elem())
-	err := req.svc.call(req.mtype, req.argv, req.replyv)
+	defer putRequest(req)
+	server.sendResponse(cc, req.h, server.invoke(req), sending)
+}
+
+// 执行请求对应的方法，返回要回复的响应体，失败时把错误写入请求头
+func (server *Server) invoke(req *request) interface{} {
+	ctx := context.Background()
+	if req.h.Metadata != nil {
+		ctx = WithMetadata(ctx, req.h.Metadata)
+	}
+	if req.callback != nil && req.mtype.withCtx {
+		ctx = context.WithValue(ctx, callbackCtx{}, req.callback)
+	}
+	err := req.svc.callContext(ctx, req.mtype, req.argv, req.replyv)
+	// 在回复之前释放许可，客户端收到响应后立即发起的下一个请求不会被误拒
+	if req.release != nil {
+		req.release()
+	}
 	if err != nil {
-		req.h.Error = err.Error()
-		server.sendResponse(cc, req.h, invalidRequest, sending)
-		return
+		setHeaderError(req.h, err)
+		return invalidRequest
 	}
-	// 使用 reflect.ValueOf () 函数将 interface {} 转成 reflect.Value 类型
-	//req.replyv = reflect.ValueOf(fmt.Sprintf("get resp %d", req.h.Sequence))
-	server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
+	return req.replyv.Interface()
 }
 
 func Accept(lis net.Listener) {
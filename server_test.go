@@ -0,0 +1,293 @@
+package goRPC
+
+import (
+	"context"
+	"errors"
+	"goRPC/codec"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startLimitedServer(t *testing.T, limits ServerLimits) string {
+	t.Helper()
+	var foo Foo
+	var slow Slow
+	server := NewServer()
+	_ = server.Register(&foo)
+	_ = server.Register(&slow)
+	server.SetLimits(limits)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return l.Addr().String()
+}
+
+func TestServer_MethodLimits(t *testing.T) {
+	addr := startLimitedServer(t, ServerLimits{
+		Methods: map[string]MethodLimits{"Slow.Sleep": {MaxConcurrency: 1}},
+	})
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	slowCall := client.Go("Slow.Sleep", 200*time.Millisecond, new(int), nil)
+	time.Sleep(50 * time.Millisecond)
+	err = client.Call("Slow.Sleep", time.Duration(0), &reply)
+	_assert(errors.Is(err, &Error{Code: ResourceExhausted}), "expect ResourceExhausted, got %v", err)
+	_assert(client.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply) == nil, "other methods must not be limited")
+	<-slowCall.Done
+	_assert(slowCall.Error == nil, "slow call fail: %v", slowCall.Error)
+	_assert(client.Call("Slow.Sleep", time.Duration(0), &reply) == nil, "limit must be released")
+}
+
+func TestServer_ConnLimits(t *testing.T) {
+	addr := startLimitedServer(t, ServerLimits{MaxConnConcurrency: 1})
+	noisy, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = noisy.Close() }()
+	quiet, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = quiet.Close() }()
+
+	var reply int
+	slowCall := noisy.Go("Slow.Sleep", 200*time.Millisecond, new(int), nil)
+	time.Sleep(50 * time.Millisecond)
+	err = noisy.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+	_assert(ErrorCode(err) == ResourceExhausted, "expect ResourceExhausted, got %v", err)
+	err = quiet.Call("Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+	_assert(err == nil && reply == 2, "other connections must not be limited: %v", err)
+	<-slowCall.Done
+}
+
+func TestServer_Workers(t *testing.T) {
+	var foo Foo
+	var slow Slow
+	server := NewServer()
+	_ = server.Register(&foo)
+	_ = server.Register(&slow)
+	server.SetWorkers(4)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen error: %v", err)
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+	slowCall := client.Go("Slow.Sleep", 100*time.Millisecond, new(int), nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply int
+			err := client.Call("Foo.Sum", Args{Num1: i, Num2: i}, &reply)
+			_assert(err == nil && reply == 2*i, "call %d fail: %v, reply %d", i, err, reply)
+		}(i)
+	}
+	wg.Wait()
+	<-slowCall.Done
+	_assert(slowCall.Error == nil, "slow call fail: %v", slowCall.Error)
+
+	// 服务运行期间可以调整协程池，批量调用同样交给协程池处理
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			server.SetWorkers(i % 3)
+			var sum1, sum2 int
+			b := client.Batch()
+			b.Add("Foo.Sum", Args{Num1: i, Num2: 1}, &sum1)
+			b.Add("Foo.Sum", Args{Num1: i, Num2: 2}, &sum2)
+			err := b.Do(context.Background())
+			_assert(err == nil && sum1 == i+1 && sum2 == i+2, "batch %d fail: %v, reply %d %d", i, err, sum1, sum2)
+		}(i)
+	}
+	wg.Wait()
+	server.SetWorkers(0)
+}
+
+func TestServer_Health(t *testing.T) {
+	server, addr := startTestServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	check := func(service string) (ServingStatus, error) {
+		var reply HealthCheckResponse
+		err := client.Call("Health.Check", HealthCheckRequest{Service: service}, &reply)
+		return reply.Status, err
+	}
+	status, err := check("")
+	_assert(err == nil && status == StatusServing, "server status %v %v", status, err)
+	status, err = check("Foo")
+	_assert(err == nil && status == StatusServing, "Foo status %v %v", status, err)
+	_, err = check("Baz")
+	_assert(ErrorCode(err) == NotFound, "expect NotFound, got %v", err)
+
+	server.SetServingStatus("Foo", StatusNotServing)
+	status, err = check("Foo")
+	_assert(err == nil && status == StatusNotServing, "Foo status %v %v", status, err)
+	status, _ = check("Bar")
+	_assert(status == StatusServing, "Bar status must not change, got %v", status)
+}
+
+type Node struct {
+	Value    int
+	Next     *Node
+	Children map[string][]Node
+}
+
+func TestServer_Reflection(t *testing.T) {
+	_, addr := startTestServer(t)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var list ListServicesResponse
+	err = client.Call("Reflection.ListServices", ListServicesRequest{}, &list)
+	_assert(err == nil, "list services error: %v", err)
+	names := make([]string, 0, len(list.Services))
+	for _, s := range list.Services {
+		names = append(names, s.Name)
+	}
+	_assert(len(names) == 5 && names[0] == "Bar" && names[1] == "Foo" && names[2] == "Health", "unexpected services %v", names)
+	_assert(len(list.Services[1].Methods) == 1 && list.Services[1].Methods[0] == "Sum", "unexpected Foo methods %v", list.Services[1].Methods)
+
+	var desc MethodDesc
+	err = client.Call("Reflection.DescribeMethod", DescribeMethodRequest{ServiceMethod: "Foo.Sum"}, &desc)
+	_assert(err == nil, "describe error: %v", err)
+	_assert(desc.ArgType.Kind == "struct" && len(desc.ArgType.Fields) == 2, "unexpected arg type %v", desc.ArgType)
+	_assert(desc.ArgType.Fields[0].Name == "Num1" && desc.ArgType.Fields[0].Type.Kind == "int", "unexpected field %v", desc.ArgType.Fields[0])
+	_assert(desc.ReplyType.Kind == "ptr" && desc.ReplyType.Elem.Kind == "int", "unexpected reply type %v", desc.ReplyType)
+
+	err = client.Call("Reflection.DescribeMethod", DescribeMethodRequest{ServiceMethod: "Foo.Mul"}, &desc)
+	_assert(ErrorCode(err) == NotFound, "expect NotFound, got %v", err)
+}
+
+func TestDescribeType_Recursive(t *testing.T) {
+	desc := describeType(reflect.TypeOf(Node{}), make(map[reflect.Type]bool))
+	_assert(len(desc.Fields) == 3, "unexpected fields %v", desc.Fields)
+	next := desc.Fields[1].Type
+	_assert(next.Kind == "ptr" && next.Elem.Ref && next.Elem.Name == "goRPC.Node", "recursive type must be a reference: %+v", next.Elem)
+	children := desc.Fields[2].Type
+	_assert(children.Key.Kind == "string" && children.Elem.Kind == "slice" && children.Elem.Elem.Ref, "unexpected map type %+v", children)
+}
+
+func startPubSubServer(t *testing.T, policy Backpressure, queueSize int) (*PubSub, string) {
+	t.Helper()
+	ps := NewPubSub(policy, queueSize)
+	server := NewServer()
+	_ = server.Register(ps)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return ps, l.Addr().String()
+}
+
+func TestPubSub(t *testing.T) {
+	ps, addr := startPubSubServer(t, BackpressureDrop, 0)
+	codecs := []codec.Type{codec.JobType, codec.JsonType, codec.ProtoType, codec.MsgpackType, codec.CborType}
+	received := make([]chan Message, len(codecs))
+	clients := make([]*Client, len(codecs))
+	for i, ct := range codecs {
+		client, err := Dial("tcp", addr, &Option{CodecType: ct})
+		_assert(err == nil, "dial error: %v", err)
+		ch := make(chan Message, 100)
+		err = client.Subscribe("news", func(m Message) { ch <- m })
+		_assert(err == nil, "%s subscribe fail: %v", ct, err)
+		_assert(errors.Is(client.Subscribe("news", nil), ErrSubscribed), "%s: expect ErrSubscribed", ct)
+		clients[i], received[i] = client, ch
+	}
+	_assert(ps.Subscribers("news") == len(codecs), "expect %d subscribers, got %d", len(codecs), ps.Subscribers("news"))
+	_assert(ps.Publish("sports", []byte("x")) == 0, "no one subscribed sports")
+
+	for i := 0; i < 10; i++ {
+		n := ps.Publish("news", []byte{byte(i)})
+		_assert(n == len(codecs), "expect %d deliveries, got %d", len(codecs), n)
+	}
+	for i, ch := range received {
+		for j := 0; j < 10; j++ {
+			select {
+			case m := <-ch:
+				_assert(m.Topic == "news" && len(m.Data) == 1 && m.Data[0] == byte(j), "%s: unexpected message %v at %d", codecs[i], m, j)
+			case <-time.After(time.Second):
+				t.Fatalf("%s: message %d not received", codecs[i], j)
+			}
+		}
+	}
+
+	// 取消订阅和关闭连接都会移除订阅者
+	_assert(clients[0].Unsubscribe("news") == nil, "unsubscribe fail")
+	_assert(ps.Subscribers("news") == len(codecs)-1, "expect %d subscribers, got %d", len(codecs)-1, ps.Subscribers("news"))
+	for _, client := range clients {
+		_ = client.Close()
+	}
+	for deadline := time.Now().Add(time.Second); ps.Subscribers("news") != 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	_assert(ps.Subscribers("news") == 0, "closed connections must be removed, got %d", ps.Subscribers("news"))
+}
+
+// 订阅者的 handler 阻塞时连续发布大消息，直到填满连接和发送队列
+func publishToSlowSubscriber(t *testing.T, policy Backpressure) (published int, client *Client, release func()) {
+	ps, addr := startPubSubServer(t, policy, 4)
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "dial error: %v", err)
+	gate := make(chan struct{})
+	err = client.Subscribe("big", func(Message) { <-gate })
+	_assert(err == nil, "subscribe fail: %v", err)
+
+	const total = 300
+	data := make([]byte, 64<<10)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for i := 0; i < total; i++ {
+			n += ps.Publish("big", data)
+		}
+		done <- n
+	}()
+	release = func() { close(gate) }
+	if policy == BackpressureBlock {
+		select {
+		case <-done:
+			t.Fatal("publish must block on a slow subscriber")
+		case <-time.After(200 * time.Millisecond):
+		}
+		release()
+		release = func() {}
+	}
+	published = <-done
+	return published, client, release
+}
+
+func TestPubSub_Backpressure(t *testing.T) {
+	published, client, release := publishToSlowSubscriber(t, BackpressureDrop)
+	_assert(published < 300, "drop policy must drop messages, published %d", published)
+	_assert(client.IsAvailable(), "drop policy must keep the connection")
+	release()
+	_ = client.Close()
+
+	published, client, release = publishToSlowSubscriber(t, BackpressureBlock)
+	_assert(published == 300, "block policy must deliver all messages, published %d", published)
+	_ = client.Close()
+	release()
+
+	_, client, release = publishToSlowSubscriber(t, BackpressureDisconnect)
+	release()
+	for deadline := time.Now().Add(2 * time.Second); client.IsAvailable() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_assert(!client.IsAvailable(), "disconnect policy must close the slow subscriber's connection")
+}
@@ -1,6 +1,7 @@
 package goRPC
 
 import (
+	"context"
 	"go/ast"
 	"log"
 	"reflect"
@@ -11,9 +12,12 @@ type methodType struct {
 	method    reflect.Method // 方法本身
 	ArgType   reflect.Type   // 第一个参数的类型
 	ReplyType reflect.Type   // 第二个参数的类型
+	withCtx   bool           // 方法的第一个参数是否为 context.Context
 	numCalls  uint64
 }
 
+var typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
@@ -55,16 +59,17 @@ func (s *service) registerMethod() {
 		method := s.typ.Method(i)
 		mType := method.Type
 		log.Println(mType)
-		// 检查输入和输出数量
-		if mType.NumIn() != 3 && mType.NumOut() != 1 {
+		// 检查输入和输出数量，方法可以额外接收一个 context.Context 作为第一个参数
+		withCtx := mType.NumIn() == 4 && mType.In(1) == typeOfContext
+		if (mType.NumIn() != 3 && !withCtx) || mType.NumOut() != 1 {
 			continue
 		}
 		// 检查输出是否为error
 		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
 			continue
 		}
-		// 从输入获取第二个和第三个参数的类型
-		argType, replyType := mType.In(1), mType.In(2)
+		// 从输入获取参数和返回值的类型
+		argType, replyType := mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			continue
 		}
@@ -73,6 +78,7 @@ func (s *service) registerMethod() {
 			method:    method,
 			ArgType:   argType,
 			ReplyType: replyType,
+			withCtx:   withCtx,
 		}
 		log.Printf("Registered %v %v %v", s.name, method.Name, mType.NumIn())
 	}
@@ -80,10 +86,22 @@ func (s *service) registerMethod() {
 
 // 通过反射值调用方法
 func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+	return s.callContext(context.Background(), m, argv, replyv)
+}
+
+// 通过反射值调用方法，方法接收 context.Context 时把 ctx 传给它
+func (s *service) callContext(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
 	atomic.AddUint64(&m.numCalls, 1)
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{argv, replyv})
-	if errInterface := returnValues[0].Interface().(error); errInterface != nil {
+	// 参数放在栈上的数组中，避免每次调用分配切片
+	var buf [4]reflect.Value
+	in := append(buf[:0], s.ins)
+	if m.withCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	in = append(in, argv, replyv)
+	returnValues := f.Call(in)
+	if errInterface := returnValues[0].Interface(); errInterface != nil {
 		return errInterface.(error)
 	}
 	return nil
@@ -29,7 +29,7 @@ func _assert(condition bool, msg string, v ...interface{}) {
 func TestNewServer(t *testing.T) {
 	var foo Foo
 	s := newService(&foo)
-	_assert(len(s.method) == 1, "new service method must have one", len(s.method))
+	_assert(len(s.method) == 1, "new service method must have one")
 	mType := s.method["Sum"]
 	_assert(mType != nil, "wrong Method")
 }
@@ -0,0 +1,89 @@
+package goRPC
+
+import (
+	"goRPC/codec"
+	"sync"
+)
+
+// serverTask 交给协程池处理的一个请求或一个批量，按值传递，不需要额外分配
+type serverTask struct {
+	server  *Server
+	cc      codec.Codec
+	req     *request
+	batch   []*request // 不为 nil 时处理整个批量，errs 是读取每个请求时的错误
+	errs    []error
+	sending *sync.Mutex
+	wg      *sync.WaitGroup
+}
+
+// workerPool 固定数量的常驻协程，所有连接共享
+type workerPool struct {
+	mu     sync.RWMutex // 提交任务时持有读锁，关闭 tasks 时持有写锁
+	closed bool
+	tasks  chan serverTask
+}
+
+func newWorkerPool(n int) *workerPool {
+	p := &workerPool{tasks: make(chan serverTask, n)}
+	for i := 0; i < n; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *workerPool) run() {
+	for t := range p.tasks {
+		if t.batch != nil {
+			t.server.handleBatch(t.cc, t.batch, t.errs, t.sending, t.wg)
+			continue
+		}
+		t.server.handleRequest(t.cc, t.req, t.sending, t.wg)
+	}
+}
+
+// 提交任务，协程池已经停止时返回 false，由调用方自己处理
+func (p *workerPool) submit(t serverTask) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	p.tasks <- t
+	return true
+}
+
+// 停止接收新任务，已经提交的任务处理完后协程退出
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+}
+
+// SetWorkers 启用协程池模式，请求交给 n 个常驻协程处理，不再为每个请求创建协程；
+// n <= 0 时恢复为每个请求一个协程。所有协程都在执行方法时，读取请求的协程会等待，
+// 因此方法内部不能同步等待发往同一个服务端的调用，也不能同步等待反向调用的结果。
+// 可以在服务运行期间调用，旧的协程池处理完已经提交的请求后退出
+func (server *Server) SetWorkers(n int) {
+	var p *workerPool
+	if n > 0 {
+		p = newWorkerPool(n)
+	}
+	if old := server.workers.Swap(p); old != nil {
+		old.stop()
+	}
+}
+
+// 交给协程池处理，没有启用协程池或协程池刚被替换时新建协程
+func (server *Server) dispatch(t serverTask) {
+	if p := server.workers.Load(); p != nil && p.submit(t) {
+		return
+	}
+	if t.batch != nil {
+		go server.handleBatch(t.cc, t.batch, t.errs, t.sending, t.wg)
+		return
+	}
+	go server.handleRequest(t.cc, t.req, t.sending, t.wg)
+}
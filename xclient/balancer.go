@@ -0,0 +1,107 @@
+package xclient
+
+import (
+	"context"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type hashKeyCtx struct{}
+
+// WithHashKey 设置一致性哈希使用的 key，ConsistentHashSelect 模式下相同 key 的调用会落到同一个服务端
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtx{}, key)
+}
+
+func hashKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKeyCtx{}).(string)
+	return key, ok
+}
+
+// 每个服务端在哈希环上的虚拟节点数，使 key 分布更均匀
+const ringReplicas = 100
+
+// hashRing 一致性哈希环
+type hashRing struct {
+	signature string            // 构建时的服务列表，列表变化时需要重建
+	hashes    []uint32          // 排好序的虚拟节点哈希值
+	nodes     map[uint32]string // 虚拟节点对应的服务端
+}
+
+func newHashRing(servers []string, signature string) *hashRing {
+	r := &hashRing{signature: signature, nodes: make(map[uint32]string)}
+	for _, s := range servers {
+		for i := 0; i < ringReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + s))
+			r.hashes = append(r.hashes, h)
+			r.nodes[h] = s
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// 从 key 的位置开始顺时针遍历哈希环，返回去重后的服务端顺序，第一个就是 key 对应的服务端
+func (r *hashRing) order(key string) []string {
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	seen := make(map[string]bool)
+	var servers []string
+	for i := 0; i < len(r.hashes); i++ {
+		s := r.nodes[r.hashes[(start+i)%len(r.hashes)]]
+		if !seen[s] {
+			seen[s] = true
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+// 服务端的未完成请求数，取自缓存的 Client，还没有建立连接的服务端视为 0
+func (xc *XClient) pending(rpcAddr string) int {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if client, ok := xc.clients[rpcAddr]; ok {
+		return client.Pending()
+	}
+	return 0
+}
+
+// 返回哈希环，服务列表变化时重建
+func (xc *XClient) hashRing(servers []string) *hashRing {
+	sorted := append([]string(nil), servers...)
+	sort.Strings(sorted)
+	signature := strings.Join(sorted, ",")
+	xc.ringMu.Lock()
+	defer xc.ringMu.Unlock()
+	if xc.ring == nil || xc.ring.signature != signature {
+		xc.ring = newHashRing(sorted, signature)
+	}
+	return xc.ring
+}
+
+// 按负载均衡策略给服务端排序，越靠前越优先，用于 XClient 自己实现的策略
+func (xc *XClient) preference(ctx context.Context, servers []string) []string {
+	ordered := append([]string(nil), servers...)
+	rand.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	switch xc.mode {
+	case LeastPendingSelect:
+		pending := make(map[string]int, len(ordered))
+		for _, s := range ordered {
+			pending[s] = xc.pending(s)
+		}
+		sort.SliceStable(ordered, func(i, j int) bool { return pending[ordered[i]] < pending[ordered[j]] })
+	case P2CSelect:
+		if len(ordered) >= 2 && xc.pending(ordered[1]) < xc.pending(ordered[0]) {
+			ordered[0], ordered[1] = ordered[1], ordered[0]
+		}
+	case ConsistentHashSelect:
+		if key, ok := hashKeyFrom(ctx); ok && len(servers) > 0 {
+			return xc.hashRing(servers).order(key)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,180 @@
+package xclient
+
+import (
+	"goRPC"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // 正常放行
+	StateOpen                         // 熔断中，拒绝所有请求
+	StateHalfOpen                     // 冷却结束，放行一个探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	Window       time.Duration        // 统计失败率的时间窗口
+	MinRequests  int                  // 窗口内请求数达到该值后才计算失败率
+	FailureRatio float64              // 失败率达到该值时熔断
+	CoolDown     time.Duration        // 熔断后多久进入 half-open 状态
+	IsFailure    func(err error) bool // 判断错误是否计入失败，nil 时使用 isTransportFailure
+}
+
+// DefaultBreakerConfig 默认的熔断器配置
+var DefaultBreakerConfig = BreakerConfig{
+	Window:       10 * time.Second,
+	MinRequests:  10,
+	FailureRatio: 0.5,
+	CoolDown:     5 * time.Second,
+}
+
+// 默认只有服务端不可用、超时和内部错误计入失败，业务错误不影响熔断
+func isTransportFailure(err error) bool {
+	switch goRPC.ErrorCode(err) {
+	case goRPC.Unavailable, goRPC.DeadlineExceeded, goRPC.Internal:
+		return true
+	}
+	return false
+}
+
+// Breaker 单个服务端地址的熔断器
+type Breaker struct {
+	cfg         BreakerConfig
+	mu          sync.Mutex
+	state       BreakerState
+	requests    int       // 当前窗口内的请求数
+	failures    int       // 当前窗口内的失败数
+	windowStart time.Time // 当前窗口的开始时间
+	openedAt    time.Time // 进入 open 状态的时间
+	probing     bool      // half-open 状态下是否已经放行了探测请求
+}
+
+func newBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{cfg: cfg, windowStart: time.Now()}
+}
+
+// State 返回当前状态，open 状态冷却结束后视为 half-open
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.state
+}
+
+// 根据时间推进状态：open 冷却结束进入 half-open，closed 状态窗口过期后重新计数
+func (b *Breaker) advance(now time.Time) {
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.cfg.CoolDown {
+			b.state = StateHalfOpen
+			b.probing = false
+		}
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.requests, b.failures = 0, 0
+			b.windowStart = now
+		}
+	}
+}
+
+// Allow 判断是否放行一个请求，half-open 状态下同一时间只放行一个探测请求。
+// 放行的请求结束后必须调用 Report
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// Report 上报一次请求的结果
+func (b *Breaker) Report(err error) {
+	isFailure := b.cfg.IsFailure
+	if isFailure == nil {
+		isFailure = isTransportFailure
+	}
+	failed := err != nil && isFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.advance(now)
+	switch b.state {
+	case StateHalfOpen:
+		b.probing = false
+		if failed {
+			b.state, b.openedAt = StateOpen, now
+			return
+		}
+		b.state = StateClosed
+		b.requests, b.failures = 0, 0
+		b.windowStart = now
+	case StateClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.FailureRatio*float64(b.requests) {
+			b.state, b.openedAt = StateOpen, now
+		}
+	}
+}
+
+// 放行的请求没有结果时调用，例如被对冲请求主动取消：不计入统计，
+// half-open 状态下允许再放行一个探测请求
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+// Breakers 按服务端地址维护熔断器，可以在多个 XClient 之间共享
+type Breakers struct {
+	cfg BreakerConfig
+	mu  sync.Mutex
+	m   map[string]*Breaker
+}
+
+// NewBreakers 创建一组使用相同配置的熔断器
+func NewBreakers(cfg BreakerConfig) *Breakers {
+	return &Breakers{cfg: cfg, m: make(map[string]*Breaker)}
+}
+
+// Get 返回地址对应的熔断器，不存在时创建
+func (bs *Breakers) Get(rpcAddr string) *Breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.m[rpcAddr]
+	if !ok {
+		b = newBreaker(bs.cfg)
+		bs.m[rpcAddr] = b
+	}
+	return b
+}
@@ -0,0 +1,130 @@
+package xclient
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SelectMode 负载均衡策略
+type SelectMode int
+
+const (
+	RandomSelect             SelectMode = iota // 随机选择
+	RoundRobinSelect                           // 轮询选择
+	WeightedRoundRobinSelect                   // 按权重平滑轮询，权重由 Discovery 提供
+	LeastPendingSelect                         // 选择未完成请求最少的服务端，由 XClient 实现
+	P2CSelect                                  // 随机选两个，取未完成请求较少的一个，由 XClient 实现
+	ConsistentHashSelect                       // 按调用的 key 一致性哈希，由 XClient 实现
+)
+
+// Discovery 服务发现接口，负责维护服务端地址列表并按策略选出一个
+type Discovery interface {
+	Refresh() error                      // 从注册中心更新服务列表
+	Update(servers []string) error       // 手动更新服务列表
+	Get(mode SelectMode) (string, error) // 根据负载均衡策略选择一个服务实例
+	GetAll() ([]string, error)           // 返回所有的服务实例
+}
+
+var ErrNoAvailableServers = errors.New("rpc discovery: no available servers")
+
+// MultiServersDiscovery 不需要注册中心，服务列表由用户手动维护
+type MultiServersDiscovery struct {
+	r       *rand.Rand   // 产生随机数
+	mu      sync.RWMutex // 保护以下字段
+	servers []string
+	index   int            // 记录轮询到的位置
+	weights map[string]int // 服务端的权重，没有配置的服务端权重为 1
+	current map[string]int // 平滑加权轮询中每个服务端的当前权重
+}
+
+var _ Discovery = (*MultiServersDiscovery)(nil)
+
+// NewMultiServerDiscovery 创建 MultiServersDiscovery 实例，index 随机初始化，避免每次都从 0 开始
+func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
+	d := &MultiServersDiscovery{
+		servers: servers,
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		current: make(map[string]int),
+	}
+	d.index = d.r.Intn(math.MaxInt32 - 1)
+	return d
+}
+
+// Refresh 对 MultiServersDiscovery 没有意义
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.current = make(map[string]int)
+	return nil
+}
+
+// UpdateWeights 更新服务端的权重，用于 WeightedRoundRobinSelect，权重小于 1 的服务端不会被选中
+func (d *MultiServersDiscovery) UpdateWeights(weights map[string]int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.weights = weights
+	d.current = make(map[string]int)
+}
+
+// 平滑加权轮询：每次给所有服务端的当前权重加上各自的权重，选出当前权重最大的，
+// 再把它的当前权重减去总权重，权重高的服务端被选中的次数多且分布均匀。调用方需要持有锁
+func (d *MultiServersDiscovery) nextWeighted() (string, error) {
+	best, total := "", 0
+	for _, s := range d.servers {
+		w := 1
+		if weight, ok := d.weights[s]; ok {
+			w = weight
+		}
+		if w <= 0 {
+			continue
+		}
+		total += w
+		d.current[s] += w
+		if best == "" || d.current[s] > d.current[best] {
+			best = s
+		}
+	}
+	if best == "" {
+		return "", ErrNoAvailableServers
+	}
+	d.current[best] -= total
+	return best, nil
+}
+
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.servers)
+	if n == 0 {
+		return "", ErrNoAvailableServers
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n]
+		d.index = (d.index + 1) % n
+		return s, nil
+	case WeightedRoundRobinSelect:
+		return d.nextWeighted()
+	default:
+		return "", errors.New("rpc discovery: not supported select mode")
+	}
+}
+
+// GetAll 返回服务列表的拷贝
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
@@ -0,0 +1,151 @@
+package xclient
+
+import (
+	"context"
+	"goRPC"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// HealthCheckDiscovery 在 Discovery 的基础上主动探测服务端的健康状态，
+// 定期调用每个服务端的 Health.Check，探测失败或状态不是 SERVING 的服务端被标记为下线，
+// Get 和 GetAll 只返回健康的服务端，恢复后重新加入
+type HealthCheckDiscovery struct {
+	Discovery               // 提供完整的服务列表
+	service   string        // 探测的服务名，为空表示整个服务端
+	interval  time.Duration // 探测间隔
+	timeout   time.Duration // 单次探测的超时时间
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.RWMutex
+	down      map[string]bool // 被标记为下线的服务端
+}
+
+var _ Discovery = (*HealthCheckDiscovery)(nil)
+var _ io.Closer = (*HealthCheckDiscovery)(nil)
+
+// NewHealthCheckDiscovery 包装 d 并立即开始探测，service 为空表示探测整个服务端的状态
+func NewHealthCheckDiscovery(d Discovery, service string, interval, timeout time.Duration) *HealthCheckDiscovery {
+	h := &HealthCheckDiscovery{
+		Discovery: d,
+		service:   service,
+		interval:  interval,
+		timeout:   timeout,
+		done:      make(chan struct{}),
+		down:      make(map[string]bool),
+	}
+	h.probeAll()
+	go h.run()
+	return h
+}
+
+func (h *HealthCheckDiscovery) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.probeAll()
+		}
+	}
+}
+
+// Close 停止探测
+func (h *HealthCheckDiscovery) Close() error {
+	h.closeOnce.Do(func() { close(h.done) })
+	return nil
+}
+
+// 并发探测所有服务端并更新下线列表
+func (h *HealthCheckDiscovery) probeAll() {
+	servers, err := h.Discovery.GetAll()
+	if err != nil {
+		return
+	}
+	down := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			if !h.probe(rpcAddr) {
+				mu.Lock()
+				down[rpcAddr] = true
+				mu.Unlock()
+			}
+		}(rpcAddr)
+	}
+	wg.Wait()
+	h.mu.Lock()
+	h.down = down
+	h.mu.Unlock()
+}
+
+// 建立一条新连接调用 Health.Check，状态为 SERVING 时返回 true
+func (h *HealthCheckDiscovery) probe(rpcAddr string) bool {
+	conn, err := net.DialTimeout("tcp", rpcAddr, h.timeout)
+	if err != nil {
+		return false
+	}
+	opt := *goRPC.DefaultOption
+	client, err := goRPC.NewClient(conn, &opt)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	var reply goRPC.HealthCheckResponse
+	err = client.CallContext(ctx, goRPC.HealthServiceName+".Check", goRPC.HealthCheckRequest{Service: h.service}, &reply)
+	return err == nil && reply.Status == goRPC.StatusServing
+}
+
+// IsHealthy 服务端最近一次探测是否健康
+func (h *HealthCheckDiscovery) IsHealthy(rpcAddr string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.down[rpcAddr]
+}
+
+// Get 按策略选择一个健康的服务端
+func (h *HealthCheckDiscovery) Get(mode SelectMode) (string, error) {
+	servers, err := h.Discovery.GetAll()
+	if err != nil {
+		return "", err
+	}
+	for range servers {
+		rpcAddr, err := h.Discovery.Get(mode)
+		if err != nil {
+			return "", err
+		}
+		if h.IsHealthy(rpcAddr) {
+			return rpcAddr, nil
+		}
+	}
+	for _, rpcAddr := range servers {
+		if h.IsHealthy(rpcAddr) {
+			return rpcAddr, nil
+		}
+	}
+	return "", ErrNoAvailableServers
+}
+
+// GetAll 返回所有健康的服务端
+func (h *HealthCheckDiscovery) GetAll() ([]string, error) {
+	servers, err := h.Discovery.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	healthy := make([]string, 0, len(servers))
+	for _, rpcAddr := range servers {
+		if h.IsHealthy(rpcAddr) {
+			healthy = append(healthy, rpcAddr)
+		}
+	}
+	return healthy, nil
+}
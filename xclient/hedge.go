@@ -0,0 +1,127 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// hedgePolicy 对冲请求配置
+type hedgePolicy struct {
+	delay     time.Duration   // 多久没有收到响应就发送下一份请求
+	maxHedges int             // 除第一次请求外最多额外发送的份数
+	methods   map[string]bool // 允许对冲的方法，只能是幂等的读操作
+}
+
+// SetHedging 为幂等的读方法启用对冲请求：第一份请求在 delay 内没有响应时，
+// 向另一个服务端再发送一份，最多额外发送 maxHedges 份，使用最先成功的响应，其余的请求被取消。
+// 没有尚未尝试过的服务端时不再发送。
+// delay 一般取该方法的 p95 延迟，需要在发起调用之前设置
+func (xc *XClient) SetHedging(delay time.Duration, maxHedges int, serviceMethods ...string) {
+	methods := make(map[string]bool)
+	for _, m := range serviceMethods {
+		methods[m] = true
+	}
+	xc.hedge = &hedgePolicy{delay: delay, maxHedges: maxHedges, methods: methods}
+}
+
+// errNoHedgeTarget 所有可用的服务端都已经发送过
+var errNoHedgeTarget = errors.New("rpc xclient: no server left to hedge")
+
+type hedgeResult struct {
+	reply reflect.Value
+	err   error
+}
+
+// reply 为 nil 或非 nil 指针时才能对冲，每份请求需要按 reply 的类型创建独立的结果
+func hedgeable(reply interface{}) bool {
+	if reply == nil {
+		return true
+	}
+	v := reflect.ValueOf(reply)
+	return v.Kind() == reflect.Ptr && !v.IsNil()
+}
+
+// 发送对冲请求。每份请求使用独立的 reply，成功的那份拷贝到调用方的 reply 中，
+// 返回前取消 ctx，其余请求从 pending 中移除，之后到达的响应会被丢弃。
+// 某一份请求失败时立即发送下一份，全部失败时返回最后一个错误。
+// 被取消的请求不上报熔断器，避免把对冲造成的取消算作服务端的结果。
+// reply 为 nil 时丢弃响应，调用方只关心是否成功
+func (xc *XClient) hedgedCall(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	maxAttempts := 1 + xc.hedge.maxHedges
+	results := make(chan hedgeResult, maxAttempts)
+	tried := make(map[string]bool)
+	var replyType reflect.Type
+	if reply != nil {
+		replyType = reflect.TypeOf(reply).Elem()
+	}
+	launched, inflight := 0, 0
+	launch := func() error {
+		rpcAddr, err := xc.pick(hctx, tried)
+		if err != nil {
+			return err
+		}
+		// pick 在没有其他可用服务端时会退回到已经尝试过的地址
+		if tried[rpcAddr] {
+			if xc.breakers != nil {
+				xc.breakers.Get(rpcAddr).release()
+			}
+			return errNoHedgeTarget
+		}
+		tried[rpcAddr] = true
+		launched++
+		inflight++
+		var replyv reflect.Value
+		var replyi interface{}
+		if replyType != nil {
+			replyv = reflect.New(replyType)
+			replyi = replyv.Interface()
+		}
+		go func() {
+			err := xc.send(hctx, rpcAddr, serviceMethod, args, replyi)
+			if xc.breakers != nil {
+				if err != nil && hctx.Err() != nil && ctx.Err() == nil {
+					xc.breakers.Get(rpcAddr).release()
+				} else {
+					xc.breakers.Get(rpcAddr).Report(err)
+				}
+			}
+			results <- hedgeResult{reply: replyv, err: err}
+		}()
+		return nil
+	}
+
+	if err := launch(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(xc.hedge.delay)
+	defer timer.Stop()
+	var lastErr error
+	for inflight > 0 {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				if replyType != nil {
+					reflect.ValueOf(reply).Elem().Set(r.reply.Elem())
+				}
+				return nil
+			}
+			lastErr = r.err
+			if launched < maxAttempts {
+				if err := launch(); err != nil && inflight == 0 {
+					return lastErr
+				}
+			}
+		case <-timer.C:
+			if launched < maxAttempts && launch() == nil && launched < maxAttempts {
+				timer.Reset(xc.hedge.delay)
+			}
+		}
+	}
+	return lastErr
+}
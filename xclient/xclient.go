@@ -0,0 +1,192 @@
+package xclient
+
+import (
+	"context"
+	"goRPC"
+	"io"
+	"sync"
+)
+
+// XClient 支持负载均衡的客户端，为每个服务端地址缓存一个 goRPC.Client
+type XClient struct {
+	d        Discovery
+	mode     SelectMode
+	opt      *goRPC.Option
+	retry    *goRPC.RetryPolicy // 重试时会换一个服务端
+	breakers *Breakers          // 按地址熔断，nil 表示不启用
+	hedge    *hedgePolicy       // 对冲请求，nil 表示不启用
+	mu       sync.Mutex         // 保护 clients
+	clients  map[string]*goRPC.Client
+	ringMu   sync.Mutex // 保护 ring
+	ring     *hashRing  // ConsistentHashSelect 使用的哈希环
+}
+
+// ErrAllBreakersOpen 所有可选的服务端都处于熔断状态
+var ErrAllBreakersOpen = goRPC.NewError(goRPC.Unavailable, "rpc xclient: all servers are circuit broken")
+
+var _ io.Closer = (*XClient)(nil)
+
+// NewXClient 创建 XClient 实例，opt 中的重试策略由 XClient 接管，底层的 Client 不再单独重试
+func NewXClient(d Discovery, mode SelectMode, opt *goRPC.Option) *XClient {
+	if opt == nil {
+		opt = goRPC.DefaultOption
+	}
+	dialOpt := *opt
+	dialOpt.Retry = nil
+	return &XClient{
+		d:       d,
+		mode:    mode,
+		opt:     &dialOpt,
+		retry:   opt.Retry,
+		clients: make(map[string]*goRPC.Client),
+	}
+}
+
+// SetBreakers 启用熔断，处于熔断状态的服务端在选择时会被跳过，冷却结束后放行一个探测请求。
+// 需要在发起调用之前设置
+func (xc *XClient) SetBreakers(breakers *Breakers) {
+	xc.breakers = breakers
+}
+
+func (xc *XClient) Close() error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for key, client := range xc.clients {
+		_ = client.Close()
+		delete(xc.clients, key)
+	}
+	return nil
+}
+
+// 复用缓存的 Client，缓存的 Client 不可用时关闭并重新建立连接。
+// 建立连接时不持有锁，多个协程同时连接同一个地址时只保留先存入的 Client
+func (xc *XClient) dial(rpcAddr string) (*goRPC.Client, error) {
+	xc.mu.Lock()
+	client, ok := xc.clients[rpcAddr]
+	if ok && client.IsAvailable() {
+		xc.mu.Unlock()
+		return client, nil
+	}
+	xc.mu.Unlock()
+
+	opt := *xc.opt
+	fresh, err := goRPC.Dial("tcp", rpcAddr, &opt)
+	if err != nil {
+		return nil, goRPC.NewError(goRPC.Unavailable, err.Error())
+	}
+
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	client, ok = xc.clients[rpcAddr]
+	if ok && client.IsAvailable() {
+		_ = fresh.Close()
+		return client, nil
+	}
+	if ok {
+		_ = client.Close()
+	}
+	xc.clients[rpcAddr] = fresh
+	return fresh, nil
+}
+
+// 向指定的服务端发起一次调用，并把结果上报给该地址的熔断器
+func (xc *XClient) call(ctx context.Context, rpcAddr string, serviceMethod string, args, reply interface{}) error {
+	err := xc.send(ctx, rpcAddr, serviceMethod, args, reply)
+	if xc.breakers != nil {
+		xc.breakers.Get(rpcAddr).Report(err)
+	}
+	return err
+}
+
+// 向指定的服务端发起调用，不上报熔断器
+func (xc *XClient) send(ctx context.Context, rpcAddr string, serviceMethod string, args, reply interface{}) error {
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	return client.CallContext(ctx, serviceMethod, args, reply)
+}
+
+// 判断地址是否可以使用：重试时避开已经失败过的地址，并跳过处于熔断状态的地址
+func (xc *XClient) usable(rpcAddr string, failed map[string]bool) bool {
+	return !failed[rpcAddr] && (xc.breakers == nil || xc.breakers.Get(rpcAddr).Allow())
+}
+
+// 选择一个服务端，先按负载均衡策略选择，选中的地址不可用时依次尝试其余地址。
+// 除了熔断以外都不可用时，退回到按策略选择
+func (xc *XClient) pick(ctx context.Context, failed map[string]bool) (string, error) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return "", err
+	}
+	switch xc.mode {
+	case LeastPendingSelect, P2CSelect, ConsistentHashSelect:
+		// 由 XClient 根据连接状态或调用的 key 排序，Discovery 只提供服务列表
+		if len(servers) == 0 {
+			return "", ErrNoAvailableServers
+		}
+		servers = xc.preference(ctx, servers)
+		for _, rpcAddr := range servers {
+			if xc.usable(rpcAddr, failed) {
+				return rpcAddr, nil
+			}
+		}
+		for _, rpcAddr := range servers {
+			if xc.usable(rpcAddr, nil) {
+				return rpcAddr, nil
+			}
+		}
+		if xc.breakers != nil {
+			return "", ErrAllBreakersOpen
+		}
+		return servers[0], nil
+	}
+	for range servers {
+		rpcAddr, err := xc.d.Get(xc.mode)
+		if err != nil {
+			return "", err
+		}
+		if xc.usable(rpcAddr, failed) {
+			return rpcAddr, nil
+		}
+	}
+	for _, rpcAddr := range servers {
+		if xc.usable(rpcAddr, failed) {
+			return rpcAddr, nil
+		}
+	}
+	for _, rpcAddr := range servers {
+		if xc.usable(rpcAddr, nil) {
+			return rpcAddr, nil
+		}
+	}
+	if xc.breakers != nil && len(servers) > 0 {
+		return "", ErrAllBreakersOpen
+	}
+	return xc.d.Get(xc.mode)
+}
+
+// Call 根据负载均衡策略选择一个服务端发起调用，
+// 配置了重试策略时，幂等方法失败后会换一个服务端重试；
+// 启用了对冲的方法改为发送对冲请求，不再重试
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if xc.hedge != nil && xc.hedge.methods[serviceMethod] && hedgeable(reply) {
+		return xc.hedgedCall(ctx, serviceMethod, args, reply)
+	}
+	failed := make(map[string]bool)
+	attempt := func(int) error {
+		rpcAddr, err := xc.pick(ctx, failed)
+		if err != nil {
+			return err
+		}
+		err = xc.call(ctx, rpcAddr, serviceMethod, args, reply)
+		if err != nil {
+			failed[rpcAddr] = true
+		}
+		return err
+	}
+	if xc.retry == nil {
+		return attempt(0)
+	}
+	return xc.retry.Do(ctx, serviceMethod, attempt)
+}
@@ -0,0 +1,317 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"goRPC"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf(msg, v...))
+	}
+}
+
+// Lookup 按配置的延迟返回自己的名字，用于区分响应来自哪个服务端
+type Lookup struct {
+	name  string
+	delay time.Duration
+	calls int32
+}
+
+func (l *Lookup) Get(key int, reply *string) error {
+	atomic.AddInt32(&l.calls, 1)
+	time.Sleep(l.delay)
+	*reply = l.name
+	return nil
+}
+
+// 启动一个注册了 Foo 和额外服务的服务端，返回监听地址
+func startServer(t *testing.T, services ...interface{}) string {
+	t.Helper()
+	_, addr := startRPCServer(t, services...)
+	return addr
+}
+
+func startRPCServer(t *testing.T, services ...interface{}) (*goRPC.Server, string) {
+	t.Helper()
+	var foo Foo
+	server := goRPC.NewServer()
+	_ = server.Register(&foo)
+	for _, svc := range services {
+		_ = server.Register(svc)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return server, l.Addr().String()
+}
+
+// 返回一个已经关闭、无法连接的地址
+func deadAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+func TestXClient_RetryOnAnotherServer(t *testing.T) {
+	live, dead := startServer(t), deadAddr(t)
+	policy := &goRPC.RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		RetryableCodes: []goRPC.Code{goRPC.Unavailable},
+	}
+	policy = policy.MarkIdempotent("Foo.Sum")
+
+	for i := 0; i < 4; i++ {
+		d := NewMultiServerDiscovery([]string{dead, live})
+		xc := NewXClient(d, RoundRobinSelect, &goRPC.Option{Retry: policy})
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "call %d fail: %v", i, err)
+		_ = xc.Close()
+	}
+}
+
+func TestXClient_NoRetryForNonIdempotent(t *testing.T) {
+	policy := &goRPC.RetryPolicy{MaxAttempts: 3, RetryableCodes: []goRPC.Code{goRPC.Unavailable}}
+	d := NewMultiServerDiscovery([]string{deadAddr(t), startServer(t)})
+	d.index = 0
+	xc := NewXClient(d, RoundRobinSelect, &goRPC.Option{Retry: policy})
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+	_assert(goRPC.ErrorCode(err) == goRPC.Unavailable, "expect Unavailable, got %v", err)
+}
+
+func TestXClient_ConcurrentDial(t *testing.T) {
+	d := NewMultiServerDiscovery([]string{startServer(t)})
+	xc := NewXClient(d, RoundRobinSelect, &goRPC.Option{})
+	defer func() { _ = xc.Close() }()
+
+	// 同时连接同一个地址时只保留一个 Client，其余的被关闭
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply int
+			err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 1}, &reply)
+			_assert(err == nil && reply == i+1, "call %d fail: %v", i, err)
+		}(i)
+	}
+	wg.Wait()
+	xc.mu.Lock()
+	n := len(xc.clients)
+	xc.mu.Unlock()
+	_assert(n == 1, "expect 1 cached client, got %d", n)
+}
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(BreakerConfig{Window: time.Minute, MinRequests: 2, FailureRatio: 0.5, CoolDown: 20 * time.Millisecond})
+	unavailable := goRPC.NewError(goRPC.Unavailable, "down")
+
+	b.Report(goRPC.NewError(goRPC.InvalidArgument, "bad args"))
+	b.Report(nil)
+	_assert(b.State() == StateClosed, "business errors must not open the breaker")
+
+	_assert(b.Allow(), "closed breaker must allow")
+	b.Report(unavailable)
+	b.Report(unavailable)
+	_assert(b.State() == StateOpen && !b.Allow(), "breaker should be open, got %v", b.State())
+
+	time.Sleep(30 * time.Millisecond)
+	_assert(b.State() == StateHalfOpen, "breaker should be half-open, got %v", b.State())
+	_assert(b.Allow() && !b.Allow(), "half-open breaker allows exactly one probe")
+	b.Report(unavailable)
+	_assert(b.State() == StateOpen, "failed probe must reopen, got %v", b.State())
+
+	time.Sleep(30 * time.Millisecond)
+	_assert(b.Allow(), "probe must be allowed after cool-down")
+	b.Report(nil)
+	_assert(b.State() == StateClosed, "successful probe must close, got %v", b.State())
+}
+
+func TestXClient_SkipOpenBreaker(t *testing.T) {
+	live, dead := startServer(t), deadAddr(t)
+	breakers := NewBreakers(BreakerConfig{Window: time.Minute, MinRequests: 1, FailureRatio: 0.5, CoolDown: time.Minute})
+	xc := NewXClient(NewMultiServerDiscovery([]string{dead, live}), RoundRobinSelect, nil)
+	xc.SetBreakers(breakers)
+	defer func() { _ = xc.Close() }()
+
+	failures := 0
+	for i := 0; i < 10; i++ {
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 1}, &reply); err != nil {
+			failures++
+		}
+	}
+	_assert(failures <= 1, "open endpoint should be skipped, %d failures", failures)
+	_assert(breakers.Get(dead).State() == StateOpen, "dead endpoint breaker should be open")
+	_assert(breakers.Get(live).State() == StateClosed, "live endpoint breaker should be closed")
+}
+
+func TestXClient_Hedging(t *testing.T) {
+	slow := startServer(t, &Lookup{name: "slow", delay: time.Second})
+	fast := startServer(t, &Lookup{name: "fast"})
+	d := NewMultiServerDiscovery([]string{slow, fast})
+	d.index = 0
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	xc.SetHedging(50*time.Millisecond, 1, "Lookup.Get")
+	defer func() { _ = xc.Close() }()
+
+	start := time.Now()
+	var reply string
+	err := xc.Call(context.Background(), "Lookup.Get", 1, &reply)
+	_assert(err == nil && reply == "fast", "hedged call fail: %v %q", err, reply)
+	_assert(time.Since(start) < 500*time.Millisecond, "hedged call took %v", time.Since(start))
+}
+
+func TestXClient_HedgingBreaker(t *testing.T) {
+	slow := startServer(t, &Lookup{name: "slow", delay: 300 * time.Millisecond})
+	fast := startServer(t, &Lookup{name: "fast"})
+	d := NewMultiServerDiscovery([]string{slow, fast})
+	d.index = 0
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	breakers := NewBreakers(BreakerConfig{Window: time.Minute, MinRequests: 1, FailureRatio: 0.5, CoolDown: time.Minute})
+	xc.SetBreakers(breakers)
+	xc.SetHedging(20*time.Millisecond, 1, "Lookup.Get")
+	defer func() { _ = xc.Close() }()
+
+	// reply 为 nil 时只关心是否成功
+	err := xc.Call(context.Background(), "Lookup.Get", 1, nil)
+	_assert(err == nil, "hedged call fail: %v", err)
+
+	// 被对冲取消的请求不计入熔断器
+	time.Sleep(50 * time.Millisecond)
+	b := breakers.Get(slow)
+	b.mu.Lock()
+	requests := b.requests
+	b.mu.Unlock()
+	_assert(requests == 0, "cancelled hedge must not be reported, got %d requests", requests)
+}
+
+func TestXClient_HedgingSingleServer(t *testing.T) {
+	lookup := &Lookup{name: "only", delay: 100 * time.Millisecond}
+	xc := NewXClient(NewMultiServerDiscovery([]string{startServer(t, lookup)}), RoundRobinSelect, nil)
+	xc.SetHedging(10*time.Millisecond, 2, "Lookup.Get")
+	defer func() { _ = xc.Close() }()
+
+	var reply string
+	err := xc.Call(context.Background(), "Lookup.Get", 1, &reply)
+	_assert(err == nil && reply == "only", "hedged call fail: %v %q", err, reply)
+	_assert(atomic.LoadInt32(&lookup.calls) == 1, "hedge must go to another server, got %d calls", lookup.calls)
+}
+
+func TestMultiServersDiscovery_WeightedRoundRobin(t *testing.T) {
+	d := NewMultiServerDiscovery([]string{"a", "b", "c"})
+	d.UpdateWeights(map[string]int{"a": 5, "b": 1, "c": 0})
+	counts := make(map[string]int)
+	for i := 0; i < 12; i++ {
+		s, err := d.Get(WeightedRoundRobinSelect)
+		_assert(err == nil, "get error: %v", err)
+		counts[s]++
+	}
+	_assert(counts["a"] == 10 && counts["b"] == 2 && counts["c"] == 0, "unexpected distribution %v", counts)
+}
+
+func TestXClient_ConsistentHash(t *testing.T) {
+	var servers []string
+	for _, name := range []string{"s1", "s2", "s3"} {
+		servers = append(servers, startServer(t, &Lookup{name: name}))
+	}
+	xc := NewXClient(NewMultiServerDiscovery(servers), ConsistentHashSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	for _, key := range []string{"user-1", "user-2", "user-3", "user-4"} {
+		ctx := WithHashKey(context.Background(), key)
+		var first string
+		for i := 0; i < 5; i++ {
+			var reply string
+			err := xc.Call(ctx, "Lookup.Get", i, &reply)
+			_assert(err == nil, "call error: %v", err)
+			if i == 0 {
+				first = reply
+			}
+			_assert(reply == first, "key %s moved from %s to %s", key, first, reply)
+		}
+	}
+}
+
+func TestXClient_LeastPending(t *testing.T) {
+	busy := startServer(t, &Lookup{name: "busy", delay: 300 * time.Millisecond})
+	idle := startServer(t, &Lookup{name: "idle", delay: 300 * time.Millisecond})
+	xc := NewXClient(NewMultiServerDiscovery([]string{busy, idle}), LeastPendingSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	// 先建立两条连接，保证 pending 数量可以被统计到
+	for _, addr := range []string{busy, idle} {
+		_assert(xc.call(context.Background(), addr, "Foo.Sum", Args{}, new(int)) == nil, "warm up %s fail", addr)
+	}
+	first := make(chan string, 1)
+	go func() {
+		var reply string
+		_ = xc.Call(context.Background(), "Lookup.Get", 0, &reply)
+		first <- reply
+	}()
+	time.Sleep(50 * time.Millisecond)
+	var reply string
+	err := xc.Call(context.Background(), "Lookup.Get", 1, &reply)
+	_assert(err == nil, "call error: %v", err)
+	_assert(reply != <-first, "both calls went to %s", reply)
+}
+
+func TestHealthCheckDiscovery(t *testing.T) {
+	server1, addr1 := startRPCServer(t)
+	_, addr2 := startRPCServer(t)
+	dead := deadAddr(t)
+	d := NewHealthCheckDiscovery(NewMultiServerDiscovery([]string{addr1, addr2, dead}), "", 20*time.Millisecond, time.Second)
+	defer func() { _ = d.Close() }()
+
+	servers, _ := d.GetAll()
+	_assert(len(servers) == 2 && !d.IsHealthy(dead), "dead endpoint must be marked down, got %v", servers)
+
+	server1.SetServingStatus("", goRPC.StatusNotServing)
+	waitHealthy(t, d, addr1, false)
+	for i := 0; i < 5; i++ {
+		s, err := d.Get(RoundRobinSelect)
+		_assert(err == nil && s == addr2, "expect %s, got %s %v", addr2, s, err)
+	}
+
+	server1.SetServingStatus("", goRPC.StatusServing)
+	waitHealthy(t, d, addr1, true)
+}
+
+// 等待探测结果变为 healthy，机器负载较高时探测可能晚于预期
+func waitHealthy(t *testing.T, d *HealthCheckDiscovery, addr string, healthy bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for d.IsHealthy(addr) != healthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %s healthy=%v", addr, healthy)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}